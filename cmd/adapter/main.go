@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -74,10 +76,18 @@ func command(out, errOut io.Writer, stopCh <-chan struct{}) *cobra.Command {
 
 	flags.StringVar(&o.RemoteKubeConfigFile, "lister-kubeconfig", o.RemoteKubeConfigFile,
 		"kubeconfig file pointing at the 'core' kubernetes server with enough rights to list any described objets")
+	flags.StringVar(&o.ProviderConfigFile, "config", o.ProviderConfigFile,
+		"YAML file with the configuration of the Sysdig metrics provider")
 	flags.DurationVar(&o.DiscoveryInterval, "discovery-interval", o.DiscoveryInterval,
 		"interval at which to refresh API discovery information")
 	flags.DurationVar(&o.SysdigRequestTimeout, "sysdig-request-timeout", o.SysdigRequestTimeout, "Deadline for requests to the Sysdig Monitor API")
 	flags.DurationVar(&o.UpdateInterval, "update-interval", o.UpdateInterval, "Refresh frequency of Sysdig Monitor API metrics")
+	flags.StringVar(&o.RegistrySnapshotFile, "registry-snapshot-file", o.RegistrySnapshotFile,
+		"file the list of Sysdig metrics is saved to, and restored from at startup when Sysdig cannot be reached")
+	flags.BoolVar(&o.AuthorizeMetricNames, "authorize-metric-names", o.AuthorizeMetricNames,
+		"also require access to each metric name, as the resource name of the virtual metricnames resource in the metrics.sysdig.com group")
+	flags.DurationVar(&o.HPASyncPeriod, "hpa-sync-period", o.HPASyncPeriod,
+		"period at which metrics referenced by HorizontalPodAutoscalers are prefetched, usually the --horizontal-pod-autoscaler-sync-period of the controller manager (0 disables prefetching)")
 
 	return cmd
 }
@@ -88,6 +98,9 @@ type adapterOpts struct {
 	// RemoteKubeConfigFile is the config used to list pods from the master API server
 	RemoteKubeConfigFile string
 
+	// ProviderConfigFile is the configuration file of the Sysdig provider
+	ProviderConfigFile string
+
 	// DiscoveryInterval is the interval at which discovery information is refreshed
 	DiscoveryInterval time.Duration
 
@@ -96,6 +109,12 @@ type adapterOpts struct {
 
 	// Refresh frequency of Sysdig Monitor API metrics
 	UpdateInterval time.Duration
+
+	// Prefetch period of the metrics referenced by HorizontalPodAutoscalers
+	HPASyncPeriod time.Duration
+
+	// File the list of Sysdig metrics is saved to and restored from
+	RegistrySnapshotFile string
 }
 
 // runCustomMetricsAdapterServer runs our CustomMetricsAdapterServer.
@@ -109,15 +128,31 @@ func (o adapterOpts) runCustomMetricsAdapterServer(stopCh <-chan struct{}) error
 	if ep := os.Getenv("SDC_ENDPOINT"); ep != "" {
 		options = append(options, sdc.SetBaseURL(ep))
 	}
-	cluster := os.Getenv("CLUSTER_NAME")
-	if cluster == "" {
-		return errors.New("Cluster name not provided - pass it via environment string CLUSTER_NAME")
+	providerConfig, err := cmprovider.LoadConfig(o.ProviderConfigFile)
+	if err != nil {
+		return err
+	}
+	if cluster := os.Getenv("CLUSTER_NAME"); len(providerConfig.Clusters) == 0 && cluster != "" {
+		providerConfig.Clusters = []string{cluster}
+	}
+	if err := providerConfig.Validate(); err != nil {
+		return errors.New("Cluster name not provided - pass it via environment string CLUSTER_NAME or the provider configuration")
 	}
-	cmprovider.SetCluster(cluster)
 	sysdigClient, err := sdc.New(nil, token, options...)
 	if err != nil {
 		return err
 	}
+	// Older on-prem backends lack some endpoints. Detection is retried on
+	// the first listing of metrics if Sysdig cannot be reached yet.
+	ctx, cancel := context.WithTimeout(context.Background(), o.SysdigRequestTimeout)
+	caps, err := sysdigClient.DetectCapabilities(ctx)
+	cancel()
+	switch {
+	case err != nil:
+		glog.Warningf("unable to detect the capabilities of Sysdig: %v", err)
+	case !caps.MetricDescriptors:
+		glog.Infof("Sysdig does not provide metric descriptors, listing metrics in the legacy format")
+	}
 
 	// Kubernetes configuration.
 	config, err := o.Config()
@@ -148,22 +183,32 @@ func (o adapterOpts) runCustomMetricsAdapterServer(stopCh <-chan struct{}) error
 	if err != nil {
 		return fmt.Errorf("unable to construct dynamic discovery mapper: %v", err)
 	}
+	dynamicMapper.RunUntil(stopCh)
 
 	clientPool := dynamic.NewClientPool(clientConfig, dynamicMapper, dynamic.LegacyAPIPathResolverFunc)
 	if err != nil {
 		return fmt.Errorf("unable to construct lister client to initialize provider: %v", err)
 	}
 
+	sysdigProvider := cmprovider.NewSysdigProvider(dynamicMapper, clientPool, sysdigClient, providerConfig, o.SysdigRequestTimeout, o.UpdateInterval, o.HPASyncPeriod, o.RegistrySnapshotFile, stopCh)
+	config.GenericConfig.HealthzChecks = append(config.GenericConfig.HealthzChecks, sysdigProvider.HealthChecks()...)
+
 	server, err := config.Complete().New(
 		// Name of the CustomMetricsAdapterServer (for logging purposes).
 		customMetricAdapterName,
 		// CustomMetricsProvider.
-		cmprovider.NewSysdigProvider(dynamicMapper, clientPool, sysdigClient, o.SysdigRequestTimeout, o.UpdateInterval, stopCh),
+		sysdigProvider,
 		// ExternalMetricsProvider (which we're not implementing)
 		nil,
 	)
 	if err != nil {
 		return err
 	}
+	readinessHandler := sysdigProvider.ReadinessHandler()
+	server.GenericAPIServer.Handler.NonGoRestfulMux.Handle(cmprovider.ReadinessPath, readinessHandler)
+	server.GenericAPIServer.Handler.NonGoRestfulMux.HandlePrefix(cmprovider.ReadinessPath+"/", readinessHandler)
+	metadataHandler := sysdigProvider.MetadataHandler()
+	server.GenericAPIServer.Handler.NonGoRestfulMux.Handle(cmprovider.MetadataPath, metadataHandler)
+	server.GenericAPIServer.Handler.NonGoRestfulMux.HandlePrefix(cmprovider.MetadataPath+"/", metadataHandler)
 	return server.GenericAPIServer.PrepareRun().Run(stopCh)
 }
@@ -0,0 +1,126 @@
+package cmprovider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// aggregationSeparator separates the name of a metric from the aggregation
+// selected in its suffix, e.g. net.http.request.time:p95:5m.
+const aggregationSeparator = ":"
+
+// defaultAggregationWindow is the window of the aggregated variants
+// advertised when no aggregation windows are configured.
+const defaultAggregationWindow = time.Minute
+
+// aggregationSuffix is the aggregation selected by the suffix of a metric
+// name, either ":<aggregation>:<window>" or ":<time>:<group>:<window>". A
+// single aggregation is used both over time and across the grouped
+// entities.
+type aggregationSuffix struct {
+	time   string
+	group  string
+	window time.Duration
+}
+
+func (a aggregationSuffix) String() string {
+	var parts []string
+	parts = append(parts, a.time)
+	if a.group != a.time {
+		parts = append(parts, a.group)
+	}
+	parts = append(parts, shortDuration(a.window))
+	return aggregationSeparator + strings.Join(parts, aggregationSeparator)
+}
+
+// shortDuration formats durations as the suffix is usually written, e.g. 5m
+// instead of 5m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// splitAggregation splits a metric name into the name of the metric and
+// the aggregation selected by its suffix. It reports false when the name
+// has no aggregation suffix.
+func splitAggregation(name string) (string, aggregationSuffix, bool, error) {
+	parts := strings.Split(name, aggregationSeparator)
+	var suffix aggregationSuffix
+	switch len(parts) {
+	case 1:
+		return name, suffix, false, nil
+	case 3:
+		suffix.time, suffix.group = parts[1], parts[1]
+	case 4:
+		suffix.time, suffix.group = parts[1], parts[2]
+	default:
+		return "", aggregationSuffix{}, false, fmt.Errorf("metric %s: expected an aggregation suffix like :p95:5m", name)
+	}
+	if parts[0] == "" || suffix.time == "" || suffix.group == "" {
+		return "", aggregationSuffix{}, false, fmt.Errorf("metric %s: empty name or aggregation", name)
+	}
+	window, err := time.ParseDuration(parts[len(parts)-1])
+	if err != nil {
+		return "", aggregationSuffix{}, false, fmt.Errorf("metric %s: invalid window: %v", name, err)
+	}
+	if err := validateAggregationWindow(window); err != nil {
+		return "", aggregationSuffix{}, false, fmt.Errorf("metric %s: %v", name, err)
+	}
+	suffix.window = window
+	return parts[0], suffix, true, nil
+}
+
+func validateAggregationWindow(window time.Duration) error {
+	if window < sampling || window%sampling != 0 {
+		return fmt.Errorf("window %s is not a multiple of %s", window, sampling)
+	}
+	return nil
+}
+
+// resolve checks the aggregations are supported by the metric, and returns
+// them spelled as in its descriptor.
+func (a aggregationSuffix) resolve(metric sdc.MetricDefinition) (aggregationSuffix, error) {
+	var ok bool
+	if a.time, ok = lookupAggregation(metric.TimeAggregations, a.time); !ok {
+		return a, fmt.Errorf("metric %s does not support time aggregation %s", metric.ID, a.time)
+	}
+	if a.group, ok = lookupAggregation(metric.GroupAggregations, a.group); !ok {
+		return a, fmt.Errorf("metric %s does not support group aggregation %s", metric.ID, a.group)
+	}
+	return a, nil
+}
+
+func lookupAggregation(supported []string, wanted string) (string, bool) {
+	for _, item := range supported {
+		if strings.EqualFold(item, wanted) {
+			return item, true
+		}
+	}
+	return wanted, false
+}
+
+// aggregationVariants returns the suffixes of the aggregated variants the
+// metric is advertised under: one per aggregation supported both over time
+// and across groups, for each of the given windows.
+func aggregationVariants(metric sdc.MetricDefinition, windows []time.Duration) []aggregationSuffix {
+	var variants []aggregationSuffix
+	for _, agg := range metric.TimeAggregations {
+		group, ok := lookupAggregation(metric.GroupAggregations, agg)
+		if !ok {
+			continue
+		}
+		for _, window := range windows {
+			variants = append(variants, aggregationSuffix{time: agg, group: group, window: window})
+		}
+	}
+	return variants
+}
@@ -0,0 +1,71 @@
+package cmprovider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestSplitAggregation(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		suffix aggregationSuffix
+		ok     bool
+		err    bool
+	}{
+		{name: "net.http.request.time", base: "net.http.request.time"},
+		{name: "net.http.request.time:p95:5m", base: "net.http.request.time", suffix: aggregationSuffix{"p95", "p95", 5 * time.Minute}, ok: true},
+		{name: "net.http.request.time:avg:max:1m", base: "net.http.request.time", suffix: aggregationSuffix{"avg", "max", time.Minute}, ok: true},
+		{name: "net.http.request.time:p95", err: true},
+		{name: "net.http.request.time:p95:soon", err: true},
+		{name: "net.http.request.time:p95:15s", err: true},
+		{name: ":max:1m", err: true},
+	}
+	for _, tt := range tests {
+		base, suffix, ok, err := splitAggregation(tt.name)
+		if have, want := err != nil, tt.err; have != want {
+			t.Errorf("splitAggregation(%s) returned error %v, expected error: %v", tt.name, err, want)
+			continue
+		}
+		if have, want := ok, tt.ok; have != want {
+			t.Errorf("splitAggregation(%s) returned %v, expected %v", tt.name, have, want)
+		}
+		if base != tt.base || suffix != tt.suffix {
+			t.Errorf("splitAggregation(%s) returned %s, %+v, expected %s, %+v", tt.name, base, suffix, tt.base, tt.suffix)
+		}
+	}
+}
+
+func TestAggregationSuffix_Resolve(t *testing.T) {
+	metric := sdc.MetricDefinition{
+		ID:                "net.http.request.time",
+		TimeAggregations:  []string{"avg", "timeAvg", "max", "p95"},
+		GroupAggregations: []string{"avg", "max", "p95"},
+	}
+	resolved, err := aggregationSuffix{"TIMEAVG", "max", time.Minute}.resolve(metric)
+	if err != nil {
+		t.Fatalf("resolve returned error: %v", err)
+	}
+	if have, want := resolved.time, "timeAvg"; have != want {
+		t.Errorf("resolve returned time aggregation %s, expected %s", have, want)
+	}
+	if _, err := (aggregationSuffix{"timeAvg", "timeAvg", time.Minute}).resolve(metric); err == nil {
+		t.Errorf("resolve accepted group aggregation timeAvg")
+	}
+
+	var have []string
+	for _, suffix := range aggregationVariants(metric, []time.Duration{time.Minute, 90 * time.Second}) {
+		have = append(have, suffix.String())
+	}
+	want := []string{":avg:1m", ":avg:1m30s", ":max:1m", ":max:1m30s", ":p95:1m", ":p95:1m30s"}
+	if len(have) != len(want) {
+		t.Fatalf("aggregationVariants returned %v, expected %v", have, want)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("aggregationVariants returned %v, expected %v", have, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package cmprovider
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// valueKey identifies a single metric value as requested by Kubernetes.
+type valueKey struct {
+	metric       string
+	namespace    string
+	name         string
+	workloadType string
+}
+
+func (k valueKey) String() string {
+	return fmt.Sprintf("%s (namespace=%s, name=%s, workloadType=%s)", k.metric, k.namespace, k.name, k.workloadType)
+}
+
+// keyFor returns the key of the value of a metric describing an object.
+// Root-scoped objects have no namespace, whichever namespace they are
+// referenced from.
+func keyFor(metric string, kind workloadKind, namespace, name string) valueKey {
+	if !kind.namespaced {
+		namespace = ""
+	}
+	return valueKey{metric: metric, namespace: namespace, name: name, workloadType: kind.name}
+}
+
+// metricSample is a value returned by Sysdig with its timestamp.
+type metricSample struct {
+	value     float64
+	timestamp time.Time
+}
+
+type cachedValue struct {
+	metricSample
+	fetchedAt time.Time
+}
+
+// valueCache holds metric values fetched in the background so they can be
+// served without waiting on Sysdig.
+type valueCache struct {
+	mu sync.RWMutex
+
+	// Entries fetched longer than maxAge ago are not served.
+	maxAge time.Duration
+
+	items map[valueKey]cachedValue
+}
+
+func newValueCache(maxAge time.Duration) *valueCache {
+	return &valueCache{
+		maxAge: maxAge,
+		items:  make(map[valueKey]cachedValue),
+	}
+}
+
+func (c *valueCache) get(key valueKey) (metricSample, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, ok := c.items[key]
+	if !ok || time.Since(item.fetchedAt) > c.maxAge {
+		return metricSample{}, false
+	}
+	return item.metricSample, true
+}
+
+// replace swaps the contents of the cache so values of metrics that are no
+// longer referenced are dropped.
+func (c *valueCache) replace(items map[valueKey]cachedValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = items
+}
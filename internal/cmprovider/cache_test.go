@@ -0,0 +1,41 @@
+package cmprovider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValueCache(t *testing.T) {
+	c := newValueCache(time.Minute)
+	key := valueKey{metric: "net.request.count", namespace: "shop", name: "api", workloadType: "deployment"}
+	expired := valueKey{metric: "net.request.count", namespace: "shop", name: "db", workloadType: "deployment"}
+	if _, ok := c.get(key); ok {
+		t.Errorf("get returned a value from an empty cache")
+	}
+	c.replace(map[valueKey]cachedValue{
+		key:     {metricSample: metricSample{value: 42}, fetchedAt: time.Now()},
+		expired: {metricSample: metricSample{value: 1}, fetchedAt: time.Now().Add(-2 * time.Minute)},
+	})
+	if sample, ok := c.get(key); !ok || sample.value != 42 {
+		t.Errorf("get returned %v, %v, expected 42", sample, ok)
+	}
+	if _, ok := c.get(expired); ok {
+		t.Errorf("get returned a value fetched longer than maxAge ago")
+	}
+	c.replace(map[valueKey]cachedValue{})
+	if _, ok := c.get(key); ok {
+		t.Errorf("get returned a value no longer prefetched")
+	}
+}
+
+func TestKeyFor(t *testing.T) {
+	config := &Config{}
+	node, _ := config.kindByName("node")
+	deployment, _ := config.kindByName("deployment")
+	if have, want := keyFor("m", node, "shop", "node-1"), (valueKey{metric: "m", name: "node-1", workloadType: "node"}); have != want {
+		t.Errorf("keyFor returned %s, expected %s", have, want)
+	}
+	if have, want := keyFor("m", deployment, "shop", "api"), (valueKey{metric: "m", namespace: "shop", name: "api", workloadType: "deployment"}); have != want {
+		t.Errorf("keyFor returned %s, expected %s", have, want)
+	}
+}
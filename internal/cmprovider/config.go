@@ -0,0 +1,295 @@
+package cmprovider
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Config is the configuration of the Sysdig provider. It is loaded from the
+// YAML file passed to the adapter with --config.
+type Config struct {
+	// Clusters are the names of the Sysdig clusters metrics are read from.
+	// The adapter defaults it to the CLUSTER_NAME environment variable.
+	Clusters []string `json:"clusters,omitempty"`
+
+	// ClusterRules read the metrics of some namespaces or Sysdig metrics
+	// from other clusters. The first matching rule applies.
+	ClusterRules []ClusterRule `json:"clusterRules,omitempty"`
+
+	// LegacyLabels scopes deployments and statefulsets by the per-kind
+	// labels of Sysdig backends predating the unified workload labels, e.g.
+	// kubernetes.deployment.name, like the v0.1 adapter.
+	LegacyLabels bool `json:"legacyLabels,omitempty"`
+
+	// ScopeLabels set the Sysdig labels the objects of some kinds are
+	// scoped by, overriding LegacyLabels.
+	ScopeLabels []ScopeLabels `json:"scopeLabels,omitempty"`
+
+	// FilterMappings scope the objects of some resources with templates,
+	// e.g. custom resources or objects named unlike their Sysdig labels.
+	FilterMappings []FilterMapping `json:"filterMappings,omitempty"`
+
+	// Tenants restrict the metrics the objects of some namespaces can be
+	// described by. The first matching policy applies, and namespaces
+	// without one can query every metric.
+	Tenants []TenantPolicy `json:"tenants,omitempty"`
+
+	// MissingData is the policy applied when Sysdig has no recent data for a
+	// metric, unless the metric sets its own.
+	MissingData *DataPolicy `json:"missingData,omitempty"`
+
+	// NameRules advertise Sysdig metrics under aliases.
+	NameRules []NameRule `json:"nameRules,omitempty"`
+
+	// DerivedMetrics are computed from expressions over Sysdig metrics.
+	DerivedMetrics []DerivedMetric `json:"derivedMetrics,omitempty"`
+
+	// AggregationWindows are the windows of the aggregated variants of
+	// metrics advertised in discovery, e.g. net.http.request.time:p95:1m.
+	// Other windows can still be requested. One minute by default.
+	AggregationWindows []metav1.Duration `json:"aggregationWindows,omitempty"`
+
+	// PercentAs is how percentages are served: "percent" from 0 to 100, the
+	// default, or "fraction" from 0 to 1.
+	PercentAs string `json:"percentAs,omitempty"`
+
+	// Metrics holds settings for individual Sysdig metrics, by Sysdig
+	// metric ID.
+	Metrics []MetricConfig `json:"metrics,omitempty"`
+
+	// RegistryFilter selects the Sysdig metrics advertised, gauges and
+	// counters by default.
+	RegistryFilter *RegistryFilter `json:"registryFilter,omitempty"`
+
+	// Discovery, when set, advertises only the metrics with recent data in
+	// the configured clusters instead of every Sysdig metric.
+	Discovery *DataDiscovery `json:"discovery,omitempty"`
+
+	metrics       map[string]MetricConfig
+	derived       map[string]*DerivedMetric
+	scopeLabels   map[string]ScopeLabels
+	workloadKinds []workloadKind
+}
+
+// MetricConfig holds the settings of a single Sysdig metric.
+type MetricConfig struct {
+	// ID of the Sysdig metric, e.g. net.request.count.
+	ID string `json:"id"`
+
+	// Rate advertises counter metrics also as a per-second rate, under the
+	// name of the metric followed by the ".rate" suffix.
+	Rate bool `json:"rate,omitempty"`
+
+	// Window is the period used to compute rates, one minute by default. It
+	// must be a multiple of the 10s sampling of the Sysdig data API.
+	Window *metav1.Duration `json:"window,omitempty"`
+
+	// PerReplica divides the value of the metric, summed across the
+	// described workload, by its number of ready replicas, so it can be
+	// compared with an average value target. The metric is then only served
+	// for kinds reporting ready replicas. Aggregated variants of the metric
+	// are not divided.
+	PerReplica bool `json:"perReplica,omitempty"`
+
+	// MissingData overrides the global missing data policy for this metric.
+	MissingData *DataPolicy `json:"missingData,omitempty"`
+}
+
+// ClusterRule selects the Sysdig clusters of some namespaces or metrics.
+type ClusterRule struct {
+	// Namespaces matched by the rule, all of them when empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Metrics matched by the rule, by Sysdig metric ID, all of them when
+	// empty.
+	Metrics []string `json:"metrics,omitempty"`
+
+	// Clusters are the names of the Sysdig clusters metrics are read from.
+	Clusters []string `json:"clusters"`
+}
+
+const defaultRateWindow = time.Minute
+
+// LoadConfig reads the provider configuration from the given file. An empty
+// path returns the default configuration.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read provider configuration: %v", err)
+		}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("unable to parse provider configuration: %v", err)
+		}
+	}
+	if err := config.complete(); err != nil {
+		return nil, fmt.Errorf("invalid provider configuration: %v", err)
+	}
+	return config, nil
+}
+
+// complete validates the configuration and indexes it for lookups.
+func (c *Config) complete() error {
+	for i, rule := range c.ClusterRules {
+		if len(rule.Clusters) == 0 {
+			return fmt.Errorf("clusterRules[%d]: no clusters", i)
+		}
+	}
+	if err := c.completeScopeLabels(); err != nil {
+		return err
+	}
+	if err := c.completeKinds(); err != nil {
+		return err
+	}
+	for i := range c.Tenants {
+		if err := c.Tenants[i].complete(); err != nil {
+			return fmt.Errorf("tenants[%d]: %v", i, err)
+		}
+	}
+	for i := range c.NameRules {
+		if err := c.NameRules[i].complete(); err != nil {
+			return fmt.Errorf("nameRules: %v", err)
+		}
+	}
+	c.derived = make(map[string]*DerivedMetric, len(c.DerivedMetrics))
+	for i := range c.DerivedMetrics {
+		d := &c.DerivedMetrics[i]
+		if err := d.complete(); err != nil {
+			return err
+		}
+		if _, ok := c.derived[d.Name]; ok {
+			return fmt.Errorf("derived metric %s configured more than once", d.Name)
+		}
+		c.derived[d.Name] = d
+	}
+	for _, window := range c.AggregationWindows {
+		if err := validateAggregationWindow(window.Duration); err != nil {
+			return fmt.Errorf("aggregationWindows: %v", err)
+		}
+	}
+	if err := validatePercentAs(c.PercentAs); err != nil {
+		return err
+	}
+	if err := c.MissingData.validate(); err != nil {
+		return fmt.Errorf("missingData: %v", err)
+	}
+	if err := c.RegistryFilter.complete(); err != nil {
+		return fmt.Errorf("registryFilter: %v", err)
+	}
+	if err := c.Discovery.validate(); err != nil {
+		return fmt.Errorf("discovery: %v", err)
+	}
+	c.metrics = make(map[string]MetricConfig, len(c.Metrics))
+	for _, m := range c.Metrics {
+		if m.ID == "" {
+			return fmt.Errorf("metric without id")
+		}
+		if _, ok := c.metrics[m.ID]; ok {
+			return fmt.Errorf("metric %s configured more than once", m.ID)
+		}
+		if m.Window != nil {
+			if err := validateAggregationWindow(m.Window.Duration); err != nil {
+				return fmt.Errorf("metric %s: %v", m.ID, err)
+			}
+		}
+		if err := m.MissingData.validate(); err != nil {
+			return fmt.Errorf("metric %s: missingData: %v", m.ID, err)
+		}
+		c.metrics[m.ID] = m
+	}
+	return nil
+}
+
+// metric returns the settings of the given Sysdig metric.
+func (c *Config) metric(id string) MetricConfig {
+	if m, ok := c.metrics[id]; ok {
+		return m
+	}
+	return MetricConfig{ID: id}
+}
+
+// aggregationWindows returns the windows of the advertised aggregated
+// variants of metrics.
+func (c *Config) aggregationWindows() []time.Duration {
+	if len(c.AggregationWindows) == 0 {
+		return []time.Duration{defaultAggregationWindow}
+	}
+	windows := make([]time.Duration, 0, len(c.AggregationWindows))
+	for _, window := range c.AggregationWindows {
+		windows = append(windows, window.Duration)
+	}
+	return windows
+}
+
+// Validate checks the configuration is complete once defaults have been
+// applied by the adapter.
+func (c *Config) Validate() error {
+	if len(c.Clusters) == 0 {
+		return fmt.Errorf("no Sysdig cluster name configured")
+	}
+	return nil
+}
+
+// clustersFor returns the Sysdig clusters the metric is read from for the
+// given namespace.
+func (c *Config) clustersFor(namespace, id string) []string {
+	for _, rule := range c.ClusterRules {
+		if rule.matches(namespace, id) {
+			return rule.Clusters
+		}
+	}
+	return c.Clusters
+}
+
+func (r ClusterRule) matches(namespace, id string) bool {
+	return (len(r.Namespaces) == 0 || contains(r.Namespaces, namespace)) &&
+		(len(r.Metrics) == 0 || contains(r.Metrics, id))
+}
+
+func contains(items []string, wanted string) bool {
+	for _, item := range items {
+		if item == wanted {
+			return true
+		}
+	}
+	return false
+}
+
+// missingData returns the missing data policy of the given Sysdig metric.
+func (c *Config) missingData(id string) *DataPolicy {
+	if m := c.metric(id); m.MissingData != nil {
+		return m.MissingData
+	}
+	if c.MissingData != nil {
+		return c.MissingData
+	}
+	return &DataPolicy{}
+}
+
+// lastKnownFor returns the longest time a last known value is served for by
+// any missing data policy, zero when no policy serves them.
+func (c *Config) lastKnownFor() time.Duration {
+	var longest time.Duration
+	policies := []*DataPolicy{c.MissingData}
+	for _, m := range c.Metrics {
+		policies = append(policies, m.MissingData)
+	}
+	for _, policy := range policies {
+		if policy.keepsLastKnown() && policy.LastKnownFor.Duration > longest {
+			longest = policy.LastKnownFor.Duration
+		}
+	}
+	return longest
+}
+
+func (m MetricConfig) window() time.Duration {
+	if m.Window == nil {
+		return defaultRateWindow
+	}
+	return m.Window.Duration
+}
@@ -0,0 +1,100 @@
+package cmprovider
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// derivedMetricType is the metric type of the definitions registered for
+// derived metrics.
+const derivedMetricType = "derived"
+
+// DerivedMetric is a metric computed from an expression over Sysdig metrics.
+type DerivedMetric struct {
+	// Name the metric is advertised under.
+	Name string `json:"name"`
+
+	// Expression computing the metric, e.g.
+	// "net.http.error.count / max(net.http.request.count, 1)". It supports
+	// numbers, Sysdig metric IDs, + - * /, parentheses and the min and max
+	// functions.
+	Expression string `json:"expression"`
+
+	expr    expr
+	metrics []string
+}
+
+func (d *DerivedMetric) complete() error {
+	if d.Name == "" {
+		return fmt.Errorf("derived metric without name")
+	}
+	e, err := parseExpression(d.Expression)
+	if err != nil {
+		return fmt.Errorf("derived metric %s: %v", d.Name, err)
+	}
+	d.expr = e
+	d.metrics = metricsOf(e)
+	if len(d.metrics) == 0 {
+		return fmt.Errorf("derived metric %s: expression does not use any metric", d.Name)
+	}
+	return nil
+}
+
+// definition returns the definition the derived metric is registered with.
+// It is only available for the kinds every metric in the expression is
+// available for. It returns false when any of them is unknown.
+func (d *DerivedMetric) definition(m sdc.Metrics) (sdc.MetricDefinition, bool) {
+	var namespaces []string
+	for i, id := range d.metrics {
+		metric, ok := m[id]
+		if !ok {
+			return sdc.MetricDefinition{}, false
+		}
+		if i == 0 {
+			namespaces = metric.Namespaces
+			continue
+		}
+		var common []string
+		for _, namespace := range namespaces {
+			if hasNamespace(metric.Namespaces, namespace) {
+				common = append(common, namespace)
+			}
+		}
+		namespaces = common
+	}
+	return sdc.MetricDefinition{
+		ID:          d.Name,
+		Description: d.Expression,
+		Namespaces:  namespaces,
+		Type:        "double",
+		MetricType:  derivedMetricType,
+	}, true
+}
+
+// eval computes the derived metric from the first sample of a response to a
+// request for every metric in the expression, in order.
+func (d *DerivedMetric) eval(payload *sdc.GetDataResponse) (metricSample, error) {
+	if len(payload.Samples) == 0 || len(payload.Samples[0].Values) < len(d.metrics) {
+		return metricSample{}, errNoValue
+	}
+	sample := payload.Samples[0]
+	values := make(map[string]float64, len(d.metrics))
+	for i, id := range d.metrics {
+		value, err := strconv.ParseFloat(string(sample.Values[i]), 64)
+		if err != nil {
+			return metricSample{}, errNoValue
+		}
+		values[id] = value
+	}
+	value, err := d.expr.eval(values)
+	if err != nil {
+		glog.V(4).Infof("unable to compute derived metric %s: %v", d.Name, err)
+		return metricSample{}, errNoValue
+	}
+	return metricSample{value: value, timestamp: time.Time(sample.Time)}, nil
+}
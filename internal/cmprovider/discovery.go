@@ -0,0 +1,151 @@
+package cmprovider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// DataDiscovery advertises only the metrics Sysdig has recent data for in
+// the configured clusters.
+type DataDiscovery struct {
+	// Window is how recent the data of advertised metrics must be, ten
+	// minutes by default.
+	Window *metav1.Duration `json:"window,omitempty"`
+
+	// BatchSize is the number of metrics checked by each Sysdig request,
+	// 100 by default.
+	BatchSize int `json:"batchSize,omitempty"`
+}
+
+const (
+	defaultDiscoveryWindow    = 10 * time.Minute
+	defaultDiscoveryBatchSize = 100
+)
+
+// clusterSegment is the label data requests are segmented by, so a single
+// request checks every configured cluster.
+const clusterSegment = "kubernetes.cluster.name"
+
+func (d *DataDiscovery) validate() error {
+	if d == nil {
+		return nil
+	}
+	if d.Window != nil {
+		if err := validateAggregationWindow(d.Window.Duration); err != nil {
+			return err
+		}
+	}
+	if d.BatchSize < 0 {
+		return fmt.Errorf("batchSize must be positive")
+	}
+	return nil
+}
+
+func (d *DataDiscovery) window() time.Duration {
+	if d.Window == nil {
+		return defaultDiscoveryWindow
+	}
+	return d.Window.Duration
+}
+
+func (d *DataDiscovery) batchSize() int {
+	if d.BatchSize == 0 {
+		return defaultDiscoveryBatchSize
+	}
+	return d.BatchSize
+}
+
+// allClusters returns every Sysdig cluster metrics can be read from.
+func (c *Config) allClusters() []string {
+	seen := make(map[string]bool)
+	var clusters []string
+	add := func(names []string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				clusters = append(clusters, name)
+			}
+		}
+	}
+	add(c.Clusters)
+	for _, rule := range c.ClusterRules {
+		add(rule.Clusters)
+	}
+	return clusters
+}
+
+// withData returns the metrics Sysdig has data for in the configured
+// clusters within the discovery window. Only the metrics the registry can
+// advertise are checked, in segmented requests of a batch of metrics each.
+func (d *DataDiscovery) withData(client *sdc.Client, timeout time.Duration, config *Config, metrics sdc.Metrics) (sdc.Metrics, error) {
+	clusters := config.allClusters()
+	var ids []string
+	for id, metric := range metrics {
+		if config.advertisable(metric) {
+			ids = append(ids, id)
+		}
+	}
+	// Sorted, so batches are the same every time.
+	sort.Strings(ids)
+	scope := filter{}.in(clusterSegment, clusters).String()
+	window := int(d.window().Seconds())
+	found := make(sdc.Metrics)
+	for start := 0; start < len(ids); start += d.batchSize() {
+		end := start + d.batchSize()
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+		req := &sdc.GetDataRequest{Last: window, Sampling: window}
+		req = req.WithMetric(clusterSegment, nil).WithFilter(scope)
+		for _, id := range batch {
+			req = req.WithMetric(id, presenceAggregation(metrics[id]))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		payload, _, err := client.Data.Get(ctx, req)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("unable to check which metrics have data: %v", err)
+		}
+		for _, sample := range payload.Samples {
+			// The first value is the cluster of the segment.
+			for i, id := range batch {
+				if i+1 < len(sample.Values) && !isNull(sample.Values[i+1]) {
+					found[id] = metrics[id]
+				}
+			}
+		}
+	}
+	glog.V(4).Infof("%d of %d metrics have data in clusters %v", len(found), len(ids), clusters)
+	return found, nil
+}
+
+// presenceAggregation returns an aggregation supported by the metric, so
+// requests checking for data are not rejected.
+func presenceAggregation(metric sdc.MetricDefinition) *sdc.MetricAggregation {
+	return &sdc.MetricAggregation{
+		Time:  supportedAggregation(metric.TimeAggregations, "max"),
+		Group: supportedAggregation(metric.GroupAggregations, "max"),
+	}
+}
+
+func supportedAggregation(supported []string, preferred string) string {
+	if len(supported) == 0 {
+		return preferred
+	}
+	if item, ok := lookupAggregation(supported, preferred); ok {
+		return item
+	}
+	return supported[0]
+}
+
+func isNull(value []byte) bool {
+	return len(value) == 0 || string(value) == "null"
+}
@@ -0,0 +1,80 @@
+package cmprovider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestDataDiscovery_WithData(t *testing.T) {
+	// Values of each metric in clusters prod and staging.
+	data := map[string][2]string{
+		"cpu.used.percent":      {"12.5", "null"},
+		"net.request.count":     {"null", "3"},
+		"net.http.request.time": {"null", "null"},
+	}
+	var requests []sdc.GetDataRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req sdc.GetDataRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("invalid request: %v", err)
+		}
+		requests = append(requests, req)
+		var samples []map[string]interface{}
+		for i, cluster := range []string{"prod", "staging"} {
+			values := []json.RawMessage{json.RawMessage(`"` + cluster + `"`)}
+			for _, m := range req.Metrics[1:] {
+				values = append(values, json.RawMessage(data[m.ID][i]))
+			}
+			samples = append(samples, map[string]interface{}{"t": 0, "d": values})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": samples})
+	}))
+	defer server.Close()
+	client := sdc.NewClient(nil, "token")
+	client.BaseURL, _ = url.Parse(server.URL + "/api/")
+
+	metrics := sdc.Metrics{
+		"cpu.used.percent":      {ID: "cpu.used.percent", MetricType: "gauge", Namespaces: []string{"kubernetes.deployment"}, TimeAggregations: []string{"avg"}},
+		"net.request.count":     {ID: "net.request.count", MetricType: "counter", Namespaces: []string{"kubernetes.deployment"}},
+		"net.http.request.time": {ID: "net.http.request.time", MetricType: "gauge", Namespaces: []string{"kubernetes.deployment"}},
+		"host.hostName":         {ID: "host.hostName", MetricType: "segmentBy", Namespaces: []string{"host"}},
+	}
+	d := &DataDiscovery{BatchSize: 2}
+	found, err := d.withData(client, time.Second, &Config{Clusters: []string{"prod", "staging"}}, metrics)
+	if err != nil {
+		t.Fatalf("withData returned error: %v", err)
+	}
+	var have []string
+	for id := range found {
+		have = append(have, id)
+	}
+	sort.Strings(have)
+	if want := []string{"cpu.used.percent", "net.request.count"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("withData returned %v, expected %v", have, want)
+	}
+
+	if have, want := len(requests), 2; have != want {
+		t.Fatalf("withData made %d requests, expected %d", have, want)
+	}
+	req := requests[0]
+	if have, want := req.Filter, "kubernetes.cluster.name in ('prod', 'staging')"; have != want {
+		t.Errorf("filter is %s, expected %s", have, want)
+	}
+	if have, want := req.Metrics[0].ID, clusterSegment; have != want {
+		t.Errorf("first metric is %s, expected the %s segment", have, want)
+	}
+	if have, want := req.Metrics[1].Aggregations, (sdc.MetricAggregation{Time: "avg", Group: "max"}); have != want {
+		t.Errorf("cpu.used.percent aggregated by %v, expected %v", have, want)
+	}
+	if have, want := req.Last, int(defaultDiscoveryWindow.Seconds()); have != want {
+		t.Errorf("window is %ds, expected %ds", have, want)
+	}
+}
@@ -0,0 +1,290 @@
+package cmprovider
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expr is an arithmetic expression over Sysdig metrics, used by derived
+// metrics. It supports numbers, metric IDs, + - * /, parentheses and the
+// min and max functions, e.g. "net.http.error.count / max(net.http.request.count, 1)".
+type expr interface {
+	eval(values map[string]float64) (float64, error)
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+type numberExpr float64
+
+func (e numberExpr) eval(map[string]float64) (float64, error) {
+	return float64(e), nil
+}
+
+type metricExpr string
+
+func (e metricExpr) eval(values map[string]float64) (float64, error) {
+	value, ok := values[string(e)]
+	if !ok {
+		return 0, fmt.Errorf("no value for metric %s", string(e))
+	}
+	return value, nil
+}
+
+type negExpr struct {
+	x expr
+}
+
+func (e negExpr) eval(values map[string]float64) (float64, error) {
+	x, err := e.x.eval(values)
+	return -x, err
+}
+
+type binaryExpr struct {
+	op   byte
+	x, y expr
+}
+
+func (e binaryExpr) eval(values map[string]float64) (float64, error) {
+	x, err := e.x.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	y, err := e.y.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	switch e.op {
+	case '+':
+		return x + y, nil
+	case '-':
+		return x - y, nil
+	case '*':
+		return x * y, nil
+	default:
+		if y == 0 {
+			return 0, errDivisionByZero
+		}
+		return x / y, nil
+	}
+}
+
+type callExpr struct {
+	fn   string
+	args []expr
+}
+
+func (e callExpr) eval(values map[string]float64) (float64, error) {
+	result := math.Inf(1)
+	if e.fn == "max" {
+		result = math.Inf(-1)
+	}
+	for _, arg := range e.args {
+		x, err := arg.eval(values)
+		if err != nil {
+			return 0, err
+		}
+		if e.fn == "max" {
+			result = math.Max(result, x)
+		} else {
+			result = math.Min(result, x)
+		}
+	}
+	return result, nil
+}
+
+// metricsOf returns the metric IDs referenced by the expression, in order of
+// appearance and without duplicates.
+func metricsOf(e expr) []string {
+	var ids []string
+	var walk func(expr)
+	walk = func(e expr) {
+		switch e := e.(type) {
+		case metricExpr:
+			for _, id := range ids {
+				if id == string(e) {
+					return
+				}
+			}
+			ids = append(ids, string(e))
+		case negExpr:
+			walk(e.x)
+		case binaryExpr:
+			walk(e.x)
+			walk(e.y)
+		case callExpr:
+			for _, arg := range e.args {
+				walk(arg)
+			}
+		}
+	}
+	walk(e)
+	return ids
+}
+
+// parseExpression parses the expression of a derived metric.
+func parseExpression(s string) (expr, error) {
+	p := &exprParser{input: s}
+	p.next()
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tok, p.tokPos)
+	}
+	return e, nil
+}
+
+// exprParser is a recursive descent parser for expressions:
+//
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | metric | ("min" | "max") "(" sum { "," sum } ")" | "(" sum ")"
+type exprParser struct {
+	input  string
+	pos    int
+	tok    string
+	tokPos int
+}
+
+func isIdentRune(r rune, first bool) bool {
+	if unicode.IsLetter(r) || r == '_' {
+		return true
+	}
+	return !first && (unicode.IsDigit(r) || r == '.')
+}
+
+// next moves to the next token. Tokens are numbers, identifiers and single
+// character operators; the empty token marks the end of the input.
+func (p *exprParser) next() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	p.tokPos = p.pos
+	if p.pos == len(p.input) {
+		p.tok = ""
+		return
+	}
+	start := p.pos
+	switch r := rune(p.input[p.pos]); {
+	case unicode.IsDigit(r) || r == '.':
+		for p.pos < len(p.input) && (unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+	case isIdentRune(r, true):
+		for p.pos < len(p.input) && isIdentRune(rune(p.input[p.pos]), false) {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.input[start:p.pos]
+}
+
+func (p *exprParser) parseSum() (expr, error) {
+	x, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok[0]
+		p.next()
+		y, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseProduct() (expr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "*" || p.tok == "/" {
+		op := p.tok[0]
+		p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.tok == "-" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	tok, pos := p.tok, p.tokPos
+	switch {
+	case tok == "":
+		return nil, errors.New("unexpected end of expression")
+	case tok == "(":
+		p.next()
+		x, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("expected \")\" at position %d", p.tokPos)
+		}
+		p.next()
+		return x, nil
+	case unicode.IsDigit(rune(tok[0])) || tok[0] == '.':
+		value, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok, pos)
+		}
+		p.next()
+		return numberExpr(value), nil
+	case isIdentRune(rune(tok[0]), true):
+		p.next()
+		if p.tok != "(" {
+			return metricExpr(tok), nil
+		}
+		return p.parseCall(strings.ToLower(tok), pos)
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", tok, pos)
+	}
+}
+
+func (p *exprParser) parseCall(fn string, pos int) (expr, error) {
+	if fn != "min" && fn != "max" {
+		return nil, fmt.Errorf("unknown function %q at position %d", fn, pos)
+	}
+	call := callExpr{fn: fn}
+	for {
+		p.next()
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if p.tok != "," {
+			break
+		}
+	}
+	if p.tok != ")" {
+		return nil, fmt.Errorf("expected \")\" at position %d", p.tokPos)
+	}
+	p.next()
+	return call, nil
+}
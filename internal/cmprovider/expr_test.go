@@ -0,0 +1,122 @@
+package cmprovider
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestParseExpression(t *testing.T) {
+	values := map[string]float64{
+		"net.http.error.count":   5,
+		"net.http.request.count": 50,
+		"cpu.cores.used":         2,
+		"zero":                   0,
+	}
+	tests := []struct {
+		expression string
+		want       float64
+		metrics    []string
+	}{
+		{"42", 42, nil},
+		{"1 + 2 * 3", 7, nil},
+		{"(1 + 2) * 3", 9, nil},
+		{"-2 - -3", 1, nil},
+		{"10 / 4 / 5", 0.5, nil},
+		{"net.http.error.count / net.http.request.count", 0.1, []string{"net.http.error.count", "net.http.request.count"}},
+		{"net.http.request.count / max(cpu.cores.used, 0.5)", 25, []string{"net.http.request.count", "cpu.cores.used"}},
+		{"min(net.http.error.count, 3, net.http.error.count)", 3, []string{"net.http.error.count"}},
+		{"MAX(zero, -1)\n+ 1", 1, []string{"zero"}},
+	}
+	for _, tt := range tests {
+		e, err := parseExpression(tt.expression)
+		if err != nil {
+			t.Errorf("parseExpression(%q) returned error: %v", tt.expression, err)
+			continue
+		}
+		have, err := e.eval(values)
+		if err != nil {
+			t.Errorf("eval(%q) returned error: %v", tt.expression, err)
+			continue
+		}
+		if have != tt.want {
+			t.Errorf("eval(%q) returned %v, expected %v", tt.expression, have, tt.want)
+		}
+		metrics := metricsOf(e)
+		if len(metrics) != len(tt.metrics) {
+			t.Errorf("metricsOf(%q) returned %v, expected %v", tt.expression, metrics, tt.metrics)
+			continue
+		}
+		for i := range metrics {
+			if metrics[i] != tt.metrics[i] {
+				t.Errorf("metricsOf(%q) returned %v, expected %v", tt.expression, metrics, tt.metrics)
+			}
+		}
+	}
+}
+
+func TestParseExpression_Errors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"avg(net.http.request.count)",
+		"max()",
+		"1 2",
+		"net.http.request.count % 2",
+	} {
+		if _, err := parseExpression(expression); err == nil {
+			t.Errorf("parseExpression(%q) returned no error", expression)
+		}
+	}
+}
+
+func TestExpression_DivisionByZero(t *testing.T) {
+	e, err := parseExpression("1 / zero")
+	if err != nil {
+		t.Fatalf("parseExpression returned error: %v", err)
+	}
+	if _, err := e.eval(map[string]float64{"zero": 0}); err != errDivisionByZero {
+		t.Errorf("eval returned %v, expected %v", err, errDivisionByZero)
+	}
+}
+
+func TestDerivedMetric(t *testing.T) {
+	d := &DerivedMetric{Name: "errors_per_request", Expression: "net.http.error.count / net.http.request.count"}
+	if err := d.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+
+	metric, ok := d.definition(sdc.Metrics{
+		"net.http.error.count":   {Namespaces: []string{"kubernetes.deployment", "kubernetes.pod"}},
+		"net.http.request.count": {Namespaces: []string{"kubernetes.deployment", "kubernetes.service"}},
+	})
+	if !ok {
+		t.Fatalf("definition returned no definition")
+	}
+	if have, want := len(metric.Namespaces), 1; have != want || metric.Namespaces[0] != "kubernetes.deployment" {
+		t.Errorf("definition returned namespaces %v, expected [kubernetes.deployment]", metric.Namespaces)
+	}
+	if _, ok := d.definition(sdc.Metrics{"net.http.error.count": {}}); ok {
+		t.Errorf("definition returned a definition with unknown metrics")
+	}
+
+	ts := time.Unix(1523864340, 0)
+	payload := &sdc.GetDataResponse{Samples: []sdc.TimeSample{
+		{Time: sdc.Timestamp(ts), Values: []json.RawMessage{json.RawMessage("5"), json.RawMessage("50")}},
+	}}
+	sample, err := d.eval(payload)
+	if err != nil {
+		t.Fatalf("eval returned error: %v", err)
+	}
+	if sample.value != 0.1 || !sample.timestamp.Equal(ts) {
+		t.Errorf("eval returned %v at %v, expected 0.1 at %v", sample.value, sample.timestamp, ts)
+	}
+
+	payload.Samples[0].Values[1] = json.RawMessage("null")
+	if _, err := d.eval(payload); err != errNoValue {
+		t.Errorf("eval returned %v, expected %v", err, errNoValue)
+	}
+}
@@ -0,0 +1,48 @@
+package cmprovider
+
+import (
+	"regexp"
+	"strings"
+)
+
+// filter builds the scope expression of a Sysdig data request out of label
+// matches joined with "and". Values are quoted, so object names, rendered
+// templates and selectors cannot alter the rest of the expression. Labels
+// are written as is, so those not built in must match sysdigLabelPattern.
+type filter []string
+
+// sysdigLabelPattern matches the Sysdig labels that can be used in filters.
+var sysdigLabelPattern = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+// equals adds a match on the given label.
+func (f filter) equals(label, value string) filter {
+	return append(f, label+"="+quoteFilterValue(value))
+}
+
+// in adds a match on the given label having any of the values.
+func (f filter) in(label string, values []string) filter {
+	if len(values) == 1 {
+		return f.equals(label, values[0])
+	}
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = quoteFilterValue(value)
+	}
+	return append(f, label+" in ("+strings.Join(quoted, ", ")+")")
+}
+
+// matches returns whether the filter has a match on the label equal to the
+// given value.
+func (f filter) matches(label, value string) bool {
+	return contains(f, label+"="+quoteFilterValue(value))
+}
+
+func (f filter) String() string {
+	return strings.Join(f, " and ")
+}
+
+var filterValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func quoteFilterValue(value string) string {
+	return "'" + filterValueEscaper.Replace(value) + "'"
+}
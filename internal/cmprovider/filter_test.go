@@ -0,0 +1,144 @@
+package cmprovider
+
+import (
+	"testing"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestWorkloadKind_Scope(t *testing.T) {
+	deployment, _ := kindByName("deployment")
+	node, _ := kindByName("node")
+	namespace, _ := kindByName("namespace")
+	tests := []struct {
+		kind      workloadKind
+		clusters  []string
+		namespace string
+		name      string
+		want      string
+	}{
+		{
+			deployment, []string{"prod"}, "default", "kuard",
+			"kubernetes.cluster.name='prod' and kubernetes.namespace.name='default' and kubernetes.workload.name='kuard' and kubernetes.workload.type='deployment'",
+		},
+		{
+			node, []string{"prod", "prod-new"}, "", "worker-1",
+			"kubernetes.cluster.name in ('prod', 'prod-new') and kubernetes.node.name='worker-1'",
+		},
+		{
+			namespace, []string{"prod"}, "", "payments",
+			"kubernetes.cluster.name='prod' and kubernetes.namespace.name='payments'",
+		},
+		{
+			deployment, []string{"prod"}, "default", "kuard' or kubernetes.namespace.name='kube-system",
+			`kubernetes.cluster.name='prod' and kubernetes.namespace.name='default' and kubernetes.workload.name='kuard\' or kubernetes.namespace.name=\'kube-system' and kubernetes.workload.type='deployment'`,
+		},
+	}
+	for _, tt := range tests {
+		if have, want := tt.kind.scope(tt.clusters, tt.namespace, tt.name).String(), tt.want; have != want {
+			t.Errorf("scope returned %s, expected %s", have, want)
+		}
+	}
+}
+
+func TestWorkloadKind_NamespaceOf(t *testing.T) {
+	deployment, _ := kindByName("deployment")
+	namespace, _ := kindByName("namespace")
+	if have, want := deployment.namespaceOf("default", "kuard"), "default"; have != want {
+		t.Errorf("namespaceOf returned %s, expected %s", have, want)
+	}
+	if have, want := namespace.namespaceOf("", "payments"), "payments"; have != want {
+		t.Errorf("namespaceOf returned %s, expected %s", have, want)
+	}
+}
+
+func TestWorkloadKind_Aggregation(t *testing.T) {
+	deployment, _ := kindByName("deployment")
+	namespace, _ := kindByName("namespace")
+	tests := []struct {
+		kind   workloadKind
+		metric sdc.MetricDefinition
+		want   string
+	}{
+		{deployment, sdc.MetricDefinition{ID: "net.request.count", MetricType: "counter", Type: "number"}, "avg"},
+		{namespace, sdc.MetricDefinition{ID: "net.request.count", MetricType: "counter", Type: "number"}, "sum"},
+		{namespace, sdc.MetricDefinition{ID: "memory.bytes.used", MetricType: "gauge", Type: "byte"}, "sum"},
+		// Ratios and durations are averaged across the namespace.
+		{namespace, sdc.MetricDefinition{ID: "cpu.used.percent", MetricType: "gauge", Type: "%"}, "avg"},
+		{namespace, sdc.MetricDefinition{ID: "fs.used.percent", MetricType: "gauge", Type: "double"}, "avg"},
+		{namespace, sdc.MetricDefinition{ID: "net.http.request.time", MetricType: "gauge", Type: "relativeTime"}, "avg"},
+	}
+	for _, tt := range tests {
+		if have := tt.kind.aggregation(tt.metric, false).Group; have != tt.want {
+			t.Errorf("aggregation of %s for kind %s returned group aggregation %s, expected %s", tt.metric.ID, tt.kind.name, have, tt.want)
+		}
+	}
+}
+
+func TestConfig_ClustersFor(t *testing.T) {
+	config := &Config{
+		Clusters: []string{"prod"},
+		ClusterRules: []ClusterRule{
+			{Namespaces: []string{"payments"}, Metrics: []string{"net.request.count"}, Clusters: []string{"payments"}},
+			{Namespaces: []string{"payments", "shop"}, Clusters: []string{"prod", "prod-new"}},
+		},
+	}
+	tests := []struct {
+		namespace string
+		metric    string
+		want      []string
+	}{
+		{"payments", "net.request.count", []string{"payments"}},
+		{"payments", "cpu.used.percent", []string{"prod", "prod-new"}},
+		{"shop", "net.request.count", []string{"prod", "prod-new"}},
+		{"default", "net.request.count", []string{"prod"}},
+	}
+	for _, tt := range tests {
+		have := config.clustersFor(tt.namespace, tt.metric)
+		if len(have) != len(tt.want) {
+			t.Errorf("clustersFor(%s, %s) returned %v, expected %v", tt.namespace, tt.metric, have, tt.want)
+			continue
+		}
+		for i := range have {
+			if have[i] != tt.want[i] {
+				t.Errorf("clustersFor(%s, %s) returned %v, expected %v", tt.namespace, tt.metric, have, tt.want)
+			}
+		}
+	}
+}
+
+func TestConfig_Labeled(t *testing.T) {
+	config := &Config{
+		LegacyLabels: true,
+		ScopeLabels: []ScopeLabels{
+			{Kind: "Service", NameLabel: "kubernetes.service.name", TypeLabel: "kubernetes.workload.type"},
+		},
+	}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{"deployment", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='default' and kubernetes.deployment.name='kuard'"},
+		{"statefulset", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='default' and kubernetes.statefulSet.name='kuard'"},
+		{"service", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='default' and kubernetes.service.name='kuard' and kubernetes.workload.type='service'"},
+		{"pod", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='default' and kubernetes.pod.name='kuard'"},
+	}
+	for _, tt := range tests {
+		kind, _ := kindByName(tt.kind)
+		if have := config.labeled(kind).scope([]string{"prod"}, "default", "kuard").String(); have != tt.want {
+			t.Errorf("scope of %s returned %s, expected %s", tt.kind, have, tt.want)
+		}
+	}
+
+	for _, labels := range []ScopeLabels{
+		{Kind: "cronjob", NameLabel: "kubernetes.cronJob.name"},
+		{Kind: "deployment"},
+	} {
+		if err := (&Config{ScopeLabels: []ScopeLabels{labels}}).complete(); err == nil {
+			t.Errorf("complete accepted scope labels %+v", labels)
+		}
+	}
+}
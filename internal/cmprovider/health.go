@@ -0,0 +1,177 @@
+package cmprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apiserver/pkg/server/healthz"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// sysdigHealthTTL is how long the reachability of Sysdig is cached, so
+// probes do not load the Sysdig API.
+const sysdigHealthTTL = time.Minute
+
+// sysdigHealth caches whether Sysdig can be reached with the configured
+// token. Successful requests made to serve metrics count as checks, so
+// Sysdig is only pinged when the adapter is idle.
+type sysdigHealth struct {
+	client  *sdc.Client
+	timeout time.Duration
+
+	// mu guards the state below. It is never held while pinging Sysdig, so
+	// requests recording their success do not wait for a ping.
+	mu        sync.Mutex
+	pinging   bool
+	checkedAt time.Time
+	err       error
+}
+
+// succeeded records a successful request to Sysdig.
+func (h *sysdigHealth) succeeded() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checkedAt = time.Now()
+	h.err = nil
+}
+
+// check returns the cached reachability of Sysdig, pinging it when the
+// cache has expired. Checks made while a ping is in flight return the last
+// result instead of pinging again.
+func (h *sysdigHealth) check() error {
+	h.mu.Lock()
+	if h.pinging || time.Since(h.checkedAt) < sysdigHealthTTL {
+		defer h.mu.Unlock()
+		return h.err
+	}
+	h.pinging = true
+	h.mu.Unlock()
+
+	err := h.ping()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pinging = false
+	h.checkedAt = time.Now()
+	h.err = err
+	return err
+}
+
+// ping returns whether Sysdig can be reached with the configured token.
+func (h *sysdigHealth) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	resp, err := h.client.Ping(ctx)
+	switch {
+	case err == nil:
+		return nil
+	case resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden):
+		return fmt.Errorf("Sysdig rejected the API token: %v", err)
+	default:
+		return fmt.Errorf("unable to reach Sysdig: %v", err)
+	}
+}
+
+// fresh returns an error unless the metric list was fetched from Sysdig
+// within the last two update intervals and is not empty.
+func (l *cachingMetricsLister) fresh() error {
+	if err := l.ready(); err != nil {
+		return err
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.restored {
+		return fmt.Errorf("serving the metric list saved at %s, not refreshed from Sysdig yet", l.loadedAt)
+	}
+	if age := time.Since(l.loadedAt); age > 2*l.updateInterval {
+		return fmt.Errorf("metric list not refreshed from Sysdig for %s", age)
+	}
+	if len(l.ListAllMetrics()) == 0 {
+		return fmt.Errorf("no metrics available from Sysdig")
+	}
+	return nil
+}
+
+// syncer is implemented by REST mappers that regenerate their mappings
+// periodically.
+type syncer interface {
+	Synced() error
+}
+
+// ReadinessPath is where the readiness of the provider is served, apart from
+// the /healthz checks of the API server so that liveness probes do not
+// restart the adapter while Sysdig is down.
+const ReadinessPath = "/readyz"
+
+// HealthChecks returns the checks to register with the /healthz checks of
+// the API server. They only fail when restarting the adapter may help:
+//
+//	rest-mapper  the REST mapper recently synced with discovery
+func (p *sysdigProvider) HealthChecks() []healthz.HealthzChecker {
+	var checks []healthz.HealthzChecker
+	if mapper, ok := p.mapper.(syncer); ok {
+		checks = append(checks, healthz.NamedCheck("rest-mapper", func(*http.Request) error {
+			return mapper.Synced()
+		}))
+	}
+	return checks
+}
+
+// readinessChecks returns the checks reporting whether the provider can
+// serve metrics:
+//
+//	metric-registry        the metric list was loaded, from Sysdig or the snapshot
+//	metric-registry-fresh  the metric list was recently refreshed from Sysdig
+//	sysdig                 Sysdig can be reached with the configured token
+func (p *sysdigProvider) readinessChecks() []healthz.HealthzChecker {
+	return []healthz.HealthzChecker{
+		healthz.NamedCheck("metric-registry", func(*http.Request) error {
+			return p.lister.ready()
+		}),
+		healthz.NamedCheck("metric-registry-fresh", func(*http.Request) error {
+			return p.lister.fresh()
+		}),
+		healthz.NamedCheck("sysdig", func(*http.Request) error {
+			return p.health.check()
+		}),
+	}
+}
+
+// ReadinessHandler serves ReadinessPath for readiness probes, which succeeds
+// once the metric list is loaded, and ReadinessPath/<check> for each of the
+// readiness checks. The other checks can fail while the adapter still serves
+// metrics, e.g. from a restored list. Failure reasons are only given for
+// individual checks, so that ReadinessPath can be public.
+func (p *sysdigProvider) ReadinessHandler() http.Handler {
+	checks := p.readinessChecks()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == ReadinessPath {
+			if err := p.lister.ready(); err != nil {
+				glog.V(6).Infof("Readiness check failed: %v", err)
+				http.Error(w, "metric-registry failed: reason withheld", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "ok")
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, ReadinessPath+"/")
+		for _, check := range checks {
+			if check.Name() != name {
+				continue
+			}
+			if err := check.Check(r); err != nil {
+				http.Error(w, fmt.Sprintf("%s failed: %v", name, err), http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "ok")
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
@@ -0,0 +1,138 @@
+package cmprovider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestSysdigHealth_Check(t *testing.T) {
+	var pings int
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	client := sdc.NewClient(nil, "token")
+	client.BaseURL, _ = url.Parse(server.URL + "/api/")
+	h := &sysdigHealth{client: client, timeout: time.Second}
+
+	if err := h.check(); err != nil {
+		t.Errorf("check returned error: %v", err)
+	}
+	status = http.StatusUnauthorized
+	if err := h.check(); err != nil || pings != 1 {
+		t.Errorf("check returned %v after %d pings, expected the cached result of 1 ping", err, pings)
+	}
+
+	h.checkedAt = time.Now().Add(-sysdigHealthTTL)
+	if err := h.check(); err == nil || !strings.Contains(err.Error(), "token") {
+		t.Errorf("check returned %v, expected the token to be rejected", err)
+	}
+	h.succeeded()
+	if err := h.check(); err != nil || pings != 2 {
+		t.Errorf("check returned %v after %d pings, expected the recorded success", err, pings)
+	}
+}
+
+func TestSysdigHealth_CheckWhilePinging(t *testing.T) {
+	pinged := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(pinged)
+		<-release
+	}))
+	defer server.Close()
+	client := sdc.NewClient(nil, "token")
+	client.BaseURL, _ = url.Parse(server.URL + "/api/")
+	h := &sysdigHealth{client: client, timeout: 10 * time.Second}
+
+	checked := make(chan error)
+	go func() { checked <- h.check() }()
+	<-pinged
+
+	// Neither recording a success nor another check waits for the ping.
+	done := make(chan struct{})
+	go func() {
+		h.succeeded()
+		h.check()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("succeeded waited for the ping in flight")
+	}
+	close(release)
+	if err := <-checked; err != nil {
+		t.Errorf("check returned error: %v", err)
+	}
+}
+
+func TestSysdigProvider_ReadinessHandler(t *testing.T) {
+	lister := &cachingMetricsLister{
+		updateInterval:  time.Minute,
+		MetricsRegistry: &registry{config: &Config{}, mapper: newTestMapper()},
+	}
+	p := &sysdigProvider{lister: lister, health: &sysdigHealth{checkedAt: time.Now()}}
+	handler := p.ReadinessHandler()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/readyz")
+	if w.Code != http.StatusServiceUnavailable || strings.Contains(w.Body.String(), "not loaded") {
+		t.Errorf("/readyz returned %d %q, expected 503 without the reason", w.Code, w.Body.String())
+	}
+	if w := get("/readyz/metric-registry"); !strings.Contains(w.Body.String(), "not loaded") {
+		t.Errorf("/readyz/metric-registry returned %q, expected the reason", w.Body.String())
+	}
+
+	// A restored list makes the adapter ready, although not fresh.
+	lister.loaded(time.Now(), true)
+	if w := get("/readyz"); w.Code != http.StatusOK {
+		t.Errorf("/readyz returned %d, expected 200", w.Code)
+	}
+	if w := get("/readyz/metric-registry-fresh"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz/metric-registry-fresh returned %d, expected 503", w.Code)
+	}
+	if w := get("/readyz/sysdig"); w.Code != http.StatusOK {
+		t.Errorf("/readyz/sysdig returned %d, expected 200", w.Code)
+	}
+	if w := get("/readyz/unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("/readyz/unknown returned %d, expected 404", w.Code)
+	}
+}
+
+func TestCachingMetricsLister_Fresh(t *testing.T) {
+	l := &cachingMetricsLister{
+		updateInterval:  time.Minute,
+		MetricsRegistry: &registry{config: &Config{}, mapper: newTestMapper()},
+	}
+	if err := l.fresh(); err == nil {
+		t.Errorf("fresh returned no error before loading metrics")
+	}
+	l.UpdateMetrics(sdc.Metrics{
+		"net.request.count": {MetricType: "counter", Namespaces: []string{"kubernetes.deployment"}},
+	})
+	l.loaded(time.Now(), true)
+	if err := l.fresh(); err == nil {
+		t.Errorf("fresh returned no error for restored metrics")
+	}
+	l.loaded(time.Now().Add(-3*time.Minute), false)
+	if err := l.fresh(); err == nil {
+		t.Errorf("fresh returned no error for metrics fetched 3 intervals ago")
+	}
+	l.loaded(time.Now(), false)
+	if err := l.fresh(); err != nil {
+		t.Errorf("fresh returned error: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package cmprovider
+
+import (
+	"fmt"
+)
+
+// ScopeLabels sets the Sysdig labels the objects of a kind are scoped by.
+type ScopeLabels struct {
+	// Kind of the objects, as in the "type;name" target format, e.g.
+	// deployment.
+	Kind string `json:"kind"`
+
+	// NameLabel is the Sysdig label matching the name of the object, e.g.
+	// kubernetes.deployment.name.
+	NameLabel string `json:"nameLabel"`
+
+	// TypeLabel is the Sysdig label matching the kind of the object, e.g.
+	// kubernetes.workload.type. The kind is not matched when empty.
+	TypeLabel string `json:"typeLabel,omitempty"`
+}
+
+// legacyScopeLabels are the labels of the Sysdig backends predating the
+// unified workload labels, used by the v0.1 adapter.
+var legacyScopeLabels = []ScopeLabels{
+	{Kind: "deployment", NameLabel: "kubernetes.deployment.name"},
+	{Kind: "statefulset", NameLabel: "kubernetes.statefulSet.name"},
+}
+
+// completeScopeLabels indexes the scope labels by kind, the configured ones
+// taking precedence over the legacy ones.
+func (c *Config) completeScopeLabels() error {
+	c.scopeLabels = make(map[string]ScopeLabels)
+	if c.LegacyLabels {
+		for _, labels := range legacyScopeLabels {
+			c.scopeLabels[labels.Kind] = labels
+		}
+	}
+	seen := make(map[string]bool)
+	for i, labels := range c.ScopeLabels {
+		kind, ok := kindByName(labels.Kind)
+		if !ok {
+			return fmt.Errorf("scopeLabels[%d]: unknown kind %q", i, labels.Kind)
+		}
+		if labels.NameLabel == "" {
+			return fmt.Errorf("scopeLabels[%d]: no nameLabel", i)
+		}
+		if seen[kind.name] {
+			return fmt.Errorf("scopeLabels[%d]: kind %s configured more than once", i, kind.name)
+		}
+		seen[kind.name] = true
+		c.scopeLabels[kind.name] = labels
+	}
+	return nil
+}
+
+// labeled returns the kind scoped by its configured Sysdig labels.
+func (c *Config) labeled(kind workloadKind) workloadKind {
+	if labels, ok := c.scopeLabels[kind.name]; ok {
+		kind.nameLabel = labels.NameLabel
+		kind.typeLabel = labels.TypeLabel
+	}
+	return kind
+}
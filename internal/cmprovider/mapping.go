@@ -0,0 +1,214 @@
+package cmprovider
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// FilterMapping maps the objects of a resource to a Sysdig scope with
+// templates, replacing the labels the resource is scoped by, if any. Metrics
+// are still restricted to the configured clusters and, for namespaced
+// resources, to the namespace of the object.
+type FilterMapping struct {
+	// Resource of the objects, e.g. deployments.apps or rollouts.argoproj.io.
+	Resource string `json:"resource"`
+
+	// Kind of the objects as named by HPA targets, e.g. Rollout. Only for
+	// resources the adapter has no built-in kind for, like custom resources.
+	Kind string `json:"kind,omitempty"`
+
+	// Namespaced is set when the objects live in a Kubernetes namespace. Only
+	// for resources the adapter has no built-in kind for.
+	Namespaced bool `json:"namespaced,omitempty"`
+
+	// SysdigNamespace that metric descriptors must list for the metric to be
+	// served for the resource, e.g. kubernetes.deployment. Only for resources
+	// the adapter has no built-in kind for.
+	SysdigNamespace string `json:"sysdigNamespace,omitempty"`
+
+	// Filter lists the Sysdig labels the objects are scoped by, with the
+	// templates of their values.
+	Filter []LabelTemplate `json:"filter"`
+
+	groupResource schema.GroupResource
+}
+
+// LabelTemplate matches a Sysdig label with the value rendered by a Go
+// template from the described object, see objectData.
+type LabelTemplate struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+
+	template *template.Template
+}
+
+// objectData is what label templates are rendered from, e.g.
+// "{{ .Labels.app }}" or "{{ owner "Deployment" }}".
+type objectData struct {
+	Name            string
+	Namespace       string
+	Labels          map[string]string
+	Annotations     map[string]string
+	OwnerReferences []metav1.OwnerReference
+}
+
+func (m *FilterMapping) complete() error {
+	if m.Resource == "" {
+		return fmt.Errorf("no resource")
+	}
+	m.groupResource = schema.ParseGroupResource(m.Resource)
+	// Like in requests, built-in resources are resolved by name, so their
+	// group can be left out, see Config.kindForResource.
+	if kind, ok := builtInKindForResource(m.groupResource.Resource); ok {
+		m.groupResource = kind.groupResource
+	}
+	if len(m.Filter) == 0 {
+		return fmt.Errorf("resource %s: no filter", m.Resource)
+	}
+	for i := range m.Filter {
+		// Objects are always matched in their own namespace, see
+		// Config.restrict. Only namespaces are named by the label.
+		if m.Filter[i].Label == namespaceLabel && m.groupResource != namespacesResource {
+			return fmt.Errorf("resource %s: filter[%d]: label %s is matched by the adapter", m.Resource, i, namespaceLabel)
+		}
+		if err := m.Filter[i].complete(); err != nil {
+			return fmt.Errorf("resource %s: filter[%d]: %v", m.Resource, i, err)
+		}
+	}
+	return nil
+}
+
+// completeCustom validates the mapping of a resource without built-in kind.
+func (m *FilterMapping) completeCustom() error {
+	if m.Kind == "" || m.SysdigNamespace == "" {
+		return fmt.Errorf("resource %s: kind and sysdigNamespace are required for resources without built-in kind", m.Resource)
+	}
+	if _, ok := kindByName(m.Kind); ok {
+		return fmt.Errorf("resource %s: kind %s is already served by another resource", m.Resource, m.Kind)
+	}
+	return nil
+}
+
+// completeBuiltIn validates the mapping of a resource with a built-in kind.
+func (m *FilterMapping) completeBuiltIn() error {
+	if m.Kind != "" || m.Namespaced || m.SysdigNamespace != "" {
+		return fmt.Errorf("resource %s has a built-in kind, only its filter can be set", m.Resource)
+	}
+	return nil
+}
+
+func (l *LabelTemplate) complete() error {
+	if !sysdigLabelPattern.MatchString(l.Label) {
+		return fmt.Errorf("invalid label %q", l.Label)
+	}
+	tmpl, err := template.New(l.Label).Funcs(template.FuncMap{
+		// Replaced when rendering, by the owners of the object.
+		"owner": func(string) (string, error) { return "", nil },
+	}).Option("missingkey=error").Parse(l.Value)
+	if err != nil {
+		return fmt.Errorf("label %s: %v", l.Label, err)
+	}
+	l.template = tmpl
+	return nil
+}
+
+// render returns the value of the label for the object, which the filter
+// builder quotes, see filter.
+func (l *LabelTemplate) render(obj objectData) (string, error) {
+	tmpl, err := l.template.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(template.FuncMap{"owner": obj.owner})
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, obj); err != nil {
+		return "", fmt.Errorf("label %s: %v", l.Label, err)
+	}
+	value := strings.TrimSpace(buf.String())
+	if value == "" {
+		return "", fmt.Errorf("label %s: empty value for %s/%s", l.Label, obj.Namespace, obj.Name)
+	}
+	return value, nil
+}
+
+// owner returns the name of the owner of the object with the given kind.
+func (o objectData) owner(kind string) (string, error) {
+	for _, ref := range o.OwnerReferences {
+		if ref.Kind == kind {
+			return ref.Name, nil
+		}
+	}
+	return "", fmt.Errorf("%s/%s has no %s owner", o.Namespace, o.Name, kind)
+}
+
+// kind returns the kind of a resource without built-in kind.
+func (m *FilterMapping) kind() workloadKind {
+	return workloadKind{
+		name:            strings.ToLower(m.Kind),
+		groupResource:   m.groupResource,
+		namespaced:      m.Namespaced,
+		sysdigNamespace: m.SysdigNamespace,
+		mapping:         m,
+	}
+}
+
+// templateScope returns the Sysdig filter matching the object in any of the
+// given Sysdig clusters, rendered by the filter mapping of the kind.
+func (k workloadKind) templateScope(clusters []string, obj objectData) (filter, error) {
+	f := filter{}.in("kubernetes.cluster.name", clusters)
+	if k.namespaced {
+		f = f.equals(namespaceLabel, obj.Namespace)
+	}
+	for i := range k.mapping.Filter {
+		label := &k.mapping.Filter[i]
+		value, err := label.render(obj)
+		if err != nil {
+			return nil, err
+		}
+		f = f.equals(label.Label, value)
+	}
+	return f, nil
+}
+
+// scope returns the Sysdig filter matching the object of the given kind in
+// any of the given Sysdig clusters. Objects of kinds with a filter mapping
+// are read from Kubernetes to render its templates.
+func (p *sysdigProvider) scope(kind workloadKind, clusters []string, namespace, name string) (filter, error) {
+	if kind.mapping == nil {
+		return kind.scope(clusters, namespace, name), nil
+	}
+	obj, err := p.objectData(kind, namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s %s/%s: %v", kind.groupResource, namespace, name, err)
+	}
+	return kind.templateScope(clusters, obj)
+}
+
+// objectData reads the object templates are rendered from.
+func (p *sysdigProvider) objectData(kind workloadKind, namespace, name string) (objectData, error) {
+	gvr, err := p.mapper.ResourceFor(kind.groupResource.WithVersion(""))
+	if err != nil {
+		return objectData{}, err
+	}
+	client, err := p.kubeClient.ClientForGroupVersionResource(gvr)
+	if err != nil {
+		return objectData{}, err
+	}
+	resource := &metav1.APIResource{Name: gvr.Resource, Namespaced: kind.namespaced}
+	obj, err := client.Resource(resource, namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return objectData{}, err
+	}
+	return objectData{
+		Name:            obj.GetName(),
+		Namespace:       obj.GetNamespace(),
+		Labels:          obj.GetLabels(),
+		Annotations:     obj.GetAnnotations(),
+		OwnerReferences: obj.GetOwnerReferences(),
+	}, nil
+}
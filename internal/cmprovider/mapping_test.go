@@ -0,0 +1,125 @@
+package cmprovider
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestWorkloadKind_TemplateScope(t *testing.T) {
+	config := &Config{FilterMappings: []FilterMapping{
+		{
+			Resource:        "rollouts.argoproj.io",
+			Kind:            "Rollout",
+			Namespaced:      true,
+			SysdigNamespace: "kubernetes.deployment",
+			Filter: []LabelTemplate{
+				{Label: "kubernetes.workload.name", Value: "{{ .Labels.app }}-{{ .Annotations.track }}"},
+				{Label: "kubernetes.workload.type", Value: "deployment"},
+			},
+		},
+		{
+			Resource: "pods",
+			Filter:   []LabelTemplate{{Label: "kubernetes.replicaSet.name", Value: `{{ owner "ReplicaSet" }}`}},
+		},
+	}}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	rollout, ok := config.kindForResource(schema.GroupResource{Group: "argoproj.io", Resource: "rollouts"})
+	if !ok {
+		t.Fatalf("kindForResource did not return the rollout kind")
+	}
+	if _, ok := config.kindForResource(schema.GroupResource{Group: "example.com", Resource: "rollouts"}); ok {
+		t.Errorf("kindForResource returned the rollout kind for another group")
+	}
+	if kind, ok := config.kindByName("rollout"); !ok || kind.groupResource != rollout.groupResource {
+		t.Errorf("kindByName returned %v, expected the rollout kind", kind)
+	}
+	metric := sdc.MetricDefinition{Namespaces: []string{"kubernetes.deployment"}}
+	if have, want := len(config.supportedKinds(metric)), 2; have != want {
+		t.Errorf("supportedKinds returned %d kinds, expected deployments and rollouts", have)
+	}
+
+	obj := objectData{
+		Name:        "api",
+		Namespace:   "shop",
+		Labels:      map[string]string{"app": "api' or kubernetes.namespace.name='kube-system"},
+		Annotations: map[string]string{"track": "stable"},
+	}
+	scope, err := rollout.templateScope([]string{"prod"}, obj)
+	if err != nil {
+		t.Fatalf("templateScope returned error: %v", err)
+	}
+	want := `kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop' and kubernetes.workload.name='api\' or kubernetes.namespace.name=\'kube-system-stable' and kubernetes.workload.type='deployment'`
+	if have := scope.String(); have != want {
+		t.Errorf("templateScope returned %s, expected %s", have, want)
+	}
+	delete(obj.Labels, "app")
+	if _, err := rollout.templateScope([]string{"prod"}, obj); err == nil {
+		t.Errorf("templateScope accepted an object without the templated label")
+	}
+
+	pod, _ := config.kindByName("pod")
+	obj = objectData{
+		Name:            "api-5d8f-x2x",
+		Namespace:       "shop",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "api-5d8f"}},
+	}
+	scope, err = pod.templateScope([]string{"prod"}, obj)
+	if err != nil {
+		t.Fatalf("templateScope returned error: %v", err)
+	}
+	want = "kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop' and kubernetes.replicaSet.name='api-5d8f'"
+	if have := scope.String(); have != want {
+		t.Errorf("templateScope returned %s, expected %s", have, want)
+	}
+	obj.OwnerReferences = nil
+	if _, err := pod.templateScope([]string{"prod"}, obj); err == nil {
+		t.Errorf("templateScope accepted a pod without owner")
+	}
+}
+
+func TestFilterMapping_Complete(t *testing.T) {
+	filter := []LabelTemplate{{Label: "kubernetes.workload.name", Value: "{{ .Name }}"}}
+	invalid := [][]FilterMapping{
+		{{Resource: "deployments.apps", Filter: []LabelTemplate{{Label: "kubernetes.workload.name='x' or a", Value: "{{ .Name }}"}}}},
+		{{Resource: "deployments.apps", Filter: []LabelTemplate{{Label: "kubernetes.workload.name", Value: "{{ .Name"}}}},
+		{{Resource: "deployments.apps"}},
+		{{Resource: "deployments.apps", Kind: "Deployment", Filter: filter}},
+		{{Resource: "rollouts.argoproj.io", Kind: "Rollout", Filter: filter}},
+		{{Resource: "rollouts.argoproj.io", Kind: "Pod", SysdigNamespace: "kubernetes.pod", Filter: filter}},
+		{{Resource: "services", Filter: filter}, {Resource: "services", Filter: filter}},
+		{{Resource: "deployments", Filter: filter}, {Resource: "deployments.apps", Filter: filter}},
+		// Objects cannot be scoped to another namespace.
+		{{Resource: "deployments.apps", Filter: []LabelTemplate{{Label: namespaceLabel, Value: "{{ .Labels.namespace }}"}}}},
+		{{Resource: "rollouts.argoproj.io", Kind: "Rollout", Namespaced: true, SysdigNamespace: "kubernetes.deployment", Filter: []LabelTemplate{{Label: namespaceLabel, Value: "billing"}}}},
+	}
+	for _, mappings := range invalid {
+		if err := (&Config{FilterMappings: mappings}).complete(); err == nil {
+			t.Errorf("complete accepted filter mappings %+v", mappings)
+		}
+	}
+}
+
+func TestFilterMapping_CompleteBuiltInResource(t *testing.T) {
+	filter := []LabelTemplate{{Label: "kubernetes.workload.name", Value: "{{ .Name }}"}}
+	// Built-in resources are found without group, or in older groups.
+	for _, resource := range []string{"deployments", "deployments.apps", "deployments.extensions"} {
+		config := &Config{FilterMappings: []FilterMapping{{Resource: resource, Filter: filter}}}
+		if err := config.complete(); err != nil {
+			t.Errorf("complete returned error for resource %s: %v", resource, err)
+			continue
+		}
+		kind, _ := config.kindByName("deployment")
+		if kind.mapping == nil {
+			t.Errorf("complete did not map the deployments to resource %s", resource)
+		}
+		if have, want := len(config.kinds()), len(workloadKinds); have != want {
+			t.Errorf("complete returned %d kinds for resource %s, expected %d", have, resource, want)
+		}
+	}
+}
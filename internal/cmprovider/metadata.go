@@ -0,0 +1,208 @@
+package cmprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	cmaprovider "github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/custom-metrics-apiserver/pkg/provider"
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// MetadataGroupVersion is the API serving the descriptors of the advertised
+// metrics, next to the custom metrics API.
+var MetadataGroupVersion = schema.GroupVersion{Group: "metrics.sysdig.com", Version: "v1alpha1"}
+
+// MetadataPath is the path the metadata API is served under.
+var MetadataPath = "/apis/" + MetadataGroupVersion.String()
+
+// descriptorsResource is the resource of the metadata API listing the
+// descriptors of the advertised metrics.
+var descriptorsResource = schema.GroupResource{Group: MetadataGroupVersion.Group, Resource: "descriptors"}
+
+// MetricDescriptor describes a metric advertised by the adapter. It is named
+// after the metric.
+type MetricDescriptor struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// ID of the Sysdig metric the metric is read from.
+	MetricID string `json:"metricID"`
+
+	// Sysdig metric type: gauge, counter or derived.
+	MetricType string `json:"metricType"`
+
+	// Sysdig value type, e.g. byte or relativeTime.
+	Type string `json:"type,omitempty"`
+
+	// Unit the values are served in, empty for plain numbers.
+	Unit string `json:"unit,omitempty"`
+
+	Scale             float64  `json:"scale,omitempty"`
+	Category          string   `json:"category,omitempty"`
+	TimeAggregations  []string `json:"timeAggregations,omitempty"`
+	GroupAggregations []string `json:"groupAggregations,omitempty"`
+
+	// Resources the metric is advertised for, e.g. deployments.apps.
+	Resources []string `json:"resources,omitempty"`
+
+	// Other names the metric is advertised under, e.g. rates and
+	// aggregations.
+	Variants []string `json:"variants,omitempty"`
+
+	// Rule of the configuration the metric comes from, e.g. a name rule.
+	Rule string `json:"rule,omitempty"`
+
+	// Settings of the Sysdig metric in the configuration.
+	Settings *MetricConfig `json:"settings,omitempty"`
+}
+
+// MetricDescriptorList is a list of metric descriptors.
+type MetricDescriptorList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []MetricDescriptor `json:"items"`
+}
+
+// descriptor returns the descriptor of the metric registered under the given
+// name.
+func (p *sysdigProvider) descriptor(name string, metric sdc.MetricDefinition) MetricDescriptor {
+	d := MetricDescriptor{
+		TypeMeta:          metav1.TypeMeta{Kind: "MetricDescriptor", APIVersion: MetadataGroupVersion.String()},
+		ObjectMeta:        metav1.ObjectMeta{Name: name},
+		MetricID:          metric.ID,
+		MetricType:        metric.MetricType,
+		Type:              metric.Type,
+		Unit:              p.config.unitOf(metric).name,
+		Scale:             metric.Scale,
+		Category:          metric.Category,
+		TimeAggregations:  metric.TimeAggregations,
+		GroupAggregations: metric.GroupAggregations,
+		Rule:              p.config.ruleFor(name, metric),
+	}
+	if settings, ok := p.config.metrics[metric.ID]; ok {
+		d.Settings = &settings
+	}
+	resources := make(map[string]bool)
+	variants := make(map[string]bool)
+	for _, info := range p.Advertised(name) {
+		resources[info.GroupResource.String()] = true
+		if info.Metric != name {
+			variants[info.Metric] = true
+		}
+	}
+	d.Resources = sortedKeys(resources)
+	d.Variants = sortedKeys(variants)
+	return d
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ruleFor describes the rule of the configuration the metric registered
+// under the given name comes from, if any.
+func (c *Config) ruleFor(name string, metric sdc.MetricDefinition) string {
+	if metric.MetricType == derivedMetricType {
+		return fmt.Sprintf("derivedMetrics: %s", metric.Description)
+	}
+	if name == cmaprovider.EncodeMetricName(metric.ID) {
+		return ""
+	}
+	// The first name rule matching the metric applies.
+	for _, rule := range c.NameRules {
+		if alias, ok := rule.alias(metric.ID); ok {
+			if cmaprovider.EncodeMetricName(alias) != name {
+				return ""
+			}
+			return fmt.Sprintf("nameRules: %s as %s", rule.Matches, rule.As)
+		}
+	}
+	return ""
+}
+
+// MetadataHandler serves the metadata API under MetadataPath:
+//
+//	/apis/metrics.sysdig.com/v1alpha1                     API resources
+//	/apis/metrics.sysdig.com/v1alpha1/descriptors         all descriptors
+//	/apis/metrics.sysdig.com/v1alpha1/descriptors/<name>  a single descriptor
+func (p *sysdigProvider) MetadataHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, apierrors.NewMethodNotSupported(descriptorsResource, strings.ToLower(r.Method)).ErrStatus)
+			return
+		}
+		path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, MetadataPath), "/")
+		switch {
+		case path == "":
+			writeJSON(w, http.StatusOK, &metav1.APIResourceList{
+				TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+				GroupVersion: MetadataGroupVersion.String(),
+				APIResources: []metav1.APIResource{{
+					Name:       descriptorsResource.Resource,
+					Namespaced: false,
+					Kind:       "MetricDescriptor",
+					Verbs:      metav1.Verbs{"get", "list"},
+				}},
+			})
+		case path == "/"+descriptorsResource.Resource:
+			defs := p.Definitions()
+			list := &MetricDescriptorList{
+				TypeMeta: metav1.TypeMeta{Kind: "MetricDescriptorList", APIVersion: MetadataGroupVersion.String()},
+				Items:    make([]MetricDescriptor, 0, len(defs)),
+			}
+			for _, name := range sortedDefinitionNames(defs) {
+				if d := p.descriptor(name, defs[name]); len(d.Resources) > 0 {
+					list.Items = append(list.Items, d)
+				}
+			}
+			writeJSON(w, http.StatusOK, list)
+		case strings.HasPrefix(path, "/"+descriptorsResource.Resource+"/"):
+			name := strings.TrimPrefix(path, "/"+descriptorsResource.Resource+"/")
+			metric, ok := p.Definitions()[name]
+			d := p.descriptor(name, metric)
+			// Metrics of resources not served by the cluster are not advertised.
+			if !ok || len(d.Resources) == 0 {
+				writeJSON(w, http.StatusNotFound, apierrors.NewNotFound(descriptorsResource, name).ErrStatus)
+				return
+			}
+			writeJSON(w, http.StatusOK, &d)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func sortedDefinitionNames(defs map[string]sdc.MetricDefinition) []string {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	if status, ok := v.(metav1.Status); ok {
+		status.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+		v = &status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		glog.Errorf("unable to write metadata response: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package cmprovider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestSysdigProvider_MetadataHandler(t *testing.T) {
+	config := &Config{
+		NameRules: []NameRule{{Matches: `^net\.http\.request\.time$`, As: "http_request_time"}},
+		Metrics:   []MetricConfig{{ID: "net.request.count", Rate: true}},
+	}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	r := &registry{config: config, mapper: newTestMapper()}
+	r.UpdateMetrics(sdc.Metrics{
+		"net.http.request.time": {
+			ID:                "net.http.request.time",
+			MetricType:        "gauge",
+			Type:              "relativeTime",
+			Category:          "network",
+			TimeAggregations:  []string{"avg", "max"},
+			GroupAggregations: []string{"avg"},
+			Namespaces:        []string{"kubernetes.deployment"},
+		},
+		"net.request.count": {
+			ID:         "net.request.count",
+			MetricType: "counter",
+			Namespaces: []string{"kubernetes.node"},
+		},
+	})
+	p := &sysdigProvider{config: config, MetricsRegistry: r}
+	handler := p.MetadataHandler()
+
+	get := func(path string, v interface{}) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, MetadataPath+path, nil))
+		if v != nil && rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+				t.Fatalf("GET %s returned invalid JSON: %v", path, err)
+			}
+		}
+		return rec.Code
+	}
+
+	var list MetricDescriptorList
+	if code := get("/descriptors", &list); code != http.StatusOK {
+		t.Fatalf("GET /descriptors returned %d", code)
+	}
+	var names []string
+	for _, d := range list.Items {
+		names = append(names, d.Name)
+	}
+	if have, want := names, []string{"http_request_time", "net.http.request.time", "net.request.count"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("GET /descriptors returned %v, expected %v", have, want)
+	}
+
+	var d MetricDescriptor
+	if code := get("/descriptors/http_request_time", &d); code != http.StatusOK {
+		t.Fatalf("GET /descriptors/http_request_time returned %d", code)
+	}
+	if have, want := d.MetricID, "net.http.request.time"; have != want {
+		t.Errorf("metricID is %s, expected %s", have, want)
+	}
+	if have, want := d.Unit, "seconds"; have != want {
+		t.Errorf("unit is %s, expected %s", have, want)
+	}
+	if have, want := d.Rule, `nameRules: ^net\.http\.request\.time$ as http_request_time`; have != want {
+		t.Errorf("rule is %s, expected %s", have, want)
+	}
+	if have, want := d.Resources, []string{"deployments.apps"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("resources are %v, expected %v", have, want)
+	}
+
+	d = MetricDescriptor{}
+	if code := get("/descriptors/net.request.count", &d); code != http.StatusOK {
+		t.Fatalf("GET /descriptors/net.request.count returned %d", code)
+	}
+	if have, want := d.Variants, []string{"net.request.count" + rateSuffix}; !reflect.DeepEqual(have, want) {
+		t.Errorf("variants are %v, expected %v", have, want)
+	}
+	if d.Settings == nil || !d.Settings.Rate {
+		t.Errorf("settings are %v, expected the rate setting", d.Settings)
+	}
+
+	if have, want := get("/descriptors/unknown", nil), http.StatusNotFound; have != want {
+		t.Errorf("GET /descriptors/unknown returned %d, expected %d", have, want)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, MetadataPath+"/descriptors/net.request.count", nil))
+	if have, want := rec.Code, http.StatusMethodNotAllowed; have != want {
+		t.Errorf("DELETE returned %d, expected %d", have, want)
+	}
+}
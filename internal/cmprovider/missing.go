@@ -0,0 +1,135 @@
+package cmprovider
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Actions available when Sysdig returns no usable sample for a metric.
+const (
+	// Report the metric as not found, so the HPA keeps its current scale.
+	MissingDataError = "error"
+
+	// Report zero. This is the default, for compatibility.
+	MissingDataZero = "zero"
+
+	// Report the last value fetched, for as long as LastKnownFor.
+	MissingDataLastKnown = "lastKnown"
+
+	// Report the configured Default value.
+	MissingDataDefault = "default"
+)
+
+// DataPolicy describes what is served when Sysdig has no usable sample for a
+// metric.
+type DataPolicy struct {
+	// Action is one of "error", "zero", "lastKnown" or "default". Defaults to
+	// "zero".
+	Action string `json:"action,omitempty"`
+
+	// LastKnownFor bounds how long the last known value is served with the
+	// "lastKnown" action.
+	LastKnownFor *metav1.Duration `json:"lastKnownFor,omitempty"`
+
+	// Default is the value served with the "default" action.
+	Default *float64 `json:"default,omitempty"`
+
+	// MaxAge rejects samples older than the given age, which are then
+	// treated as missing. Disabled when not set.
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+func (d *DataPolicy) validate() error {
+	if d == nil {
+		return nil
+	}
+	switch d.Action {
+	case "", MissingDataError, MissingDataZero:
+	case MissingDataLastKnown:
+		if d.LastKnownFor == nil || d.LastKnownFor.Duration <= 0 {
+			return fmt.Errorf("action %q requires a positive lastKnownFor", d.Action)
+		}
+	case MissingDataDefault:
+		if d.Default == nil {
+			return fmt.Errorf("action %q requires a default value", d.Action)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", d.Action)
+	}
+	if d.MaxAge != nil && d.MaxAge.Duration <= 0 {
+		return fmt.Errorf("maxAge must be positive")
+	}
+	return nil
+}
+
+// keepsLastKnown reports whether the policy serves last known values, which
+// must then be remembered.
+func (d *DataPolicy) keepsLastKnown() bool {
+	return d != nil && d.Action == MissingDataLastKnown
+}
+
+// stale reports whether the sample is older than the policy allows.
+func (d *DataPolicy) stale(sample metricSample, now time.Time) bool {
+	return d.MaxAge != nil && now.Sub(sample.timestamp) > d.MaxAge.Duration
+}
+
+// apply returns the sample served in place of missing data for the given key.
+func (d *DataPolicy) apply(key valueKey, lastKnown *lastKnownValues, now time.Time) (metricSample, error) {
+	switch d.Action {
+	case MissingDataError:
+		return metricSample{}, errNoValue
+	case MissingDataLastKnown:
+		sample, ok := lastKnown.get(key)
+		if !ok || now.Sub(sample.timestamp) > d.LastKnownFor.Duration {
+			return metricSample{}, errNoValue
+		}
+		glog.V(4).Infof("No data for metric %s, serving last known value from %s", key, sample.timestamp)
+		return sample, nil
+	case MissingDataDefault:
+		return metricSample{value: *d.Default, timestamp: now}, nil
+	default:
+		return metricSample{value: 0, timestamp: now}, nil
+	}
+}
+
+// lastKnownValues remembers the last sample fetched for the metric values
+// served by the "lastKnown" policy. Samples older than maxAge can no longer be
+// served and are evicted, so values of deleted objects are not kept forever.
+type lastKnownValues struct {
+	mu      sync.RWMutex
+	items   map[valueKey]metricSample
+	maxAge  time.Duration
+	evicted time.Time
+}
+
+func newLastKnownValues(maxAge time.Duration) *lastKnownValues {
+	return &lastKnownValues{items: make(map[valueKey]metricSample), maxAge: maxAge}
+}
+
+func (l *lastKnownValues) get(key valueKey) (metricSample, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	sample, ok := l.items[key]
+	return sample, ok
+}
+
+// remember stores the sample and, at most once per maxAge, evicts the
+// samples older than maxAge.
+func (l *lastKnownValues) remember(key valueKey, sample metricSample, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items[key] = sample
+	if now.Sub(l.evicted) < l.maxAge {
+		return
+	}
+	for key, sample := range l.items {
+		if now.Sub(sample.timestamp) > l.maxAge {
+			delete(l.items, key)
+		}
+	}
+	l.evicted = now
+}
@@ -0,0 +1,103 @@
+package cmprovider
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDataPolicy_Apply(t *testing.T) {
+	now := time.Unix(1523864350, 0)
+	key := valueKey{metric: "net.request.count", namespace: "default", name: "kuard", workloadType: "deployment"}
+	lastKnown := newLastKnownValues(5 * time.Minute)
+	lastKnown.remember(key, metricSample{value: 42, timestamp: now.Add(-time.Minute)}, now)
+	defaultValue := 7.0
+
+	tests := []struct {
+		name   string
+		policy DataPolicy
+		key    valueKey
+		want   float64
+		err    error
+	}{
+		{"zero by default", DataPolicy{}, key, 0, nil},
+		{"error", DataPolicy{Action: MissingDataError}, key, 0, errNoValue},
+		{"default", DataPolicy{Action: MissingDataDefault, Default: &defaultValue}, key, 7, nil},
+		{"last known", DataPolicy{Action: MissingDataLastKnown, LastKnownFor: &metav1.Duration{Duration: 5 * time.Minute}}, key, 42, nil},
+		{"last known expired", DataPolicy{Action: MissingDataLastKnown, LastKnownFor: &metav1.Duration{Duration: 30 * time.Second}}, key, 0, errNoValue},
+		{"last known unknown", DataPolicy{Action: MissingDataLastKnown, LastKnownFor: &metav1.Duration{Duration: 5 * time.Minute}}, valueKey{metric: "other"}, 0, errNoValue},
+	}
+	for _, tt := range tests {
+		sample, err := tt.policy.apply(tt.key, lastKnown, now)
+		if err != tt.err {
+			t.Errorf("%s: apply returned error %v, expected %v", tt.name, err, tt.err)
+			continue
+		}
+		if have, want := sample.value, tt.want; have != want {
+			t.Errorf("%s: apply returned %v, expected %v", tt.name, have, want)
+		}
+	}
+}
+
+func TestDataPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		policy *DataPolicy
+		valid  bool
+	}{
+		{nil, true},
+		{&DataPolicy{Action: MissingDataZero}, true},
+		{&DataPolicy{Action: "panic"}, false},
+		{&DataPolicy{Action: MissingDataDefault}, false},
+		{&DataPolicy{Action: MissingDataLastKnown}, false},
+		{&DataPolicy{MaxAge: &metav1.Duration{}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.validate(); (err == nil) != tt.valid {
+			t.Errorf("validate(%+v) returned %v, expected valid=%v", tt.policy, err, tt.valid)
+		}
+	}
+}
+
+func TestLastKnownValues_Evict(t *testing.T) {
+	now := time.Unix(1523864350, 0)
+	old := valueKey{metric: "net.request.count", namespace: "default", name: "kuard-1", workloadType: "pod"}
+	recent := valueKey{metric: "net.request.count", namespace: "default", name: "kuard-2", workloadType: "pod"}
+	lastKnown := newLastKnownValues(5 * time.Minute)
+	lastKnown.remember(old, metricSample{value: 1, timestamp: now}, now)
+
+	// Samples are only evicted once per maxAge.
+	now = now.Add(time.Minute)
+	lastKnown.remember(recent, metricSample{value: 2, timestamp: now}, now)
+	if have, want := len(lastKnown.items), 2; have != want {
+		t.Errorf("lastKnownValues holds %d samples, expected %d", have, want)
+	}
+
+	now = now.Add(5 * time.Minute)
+	lastKnown.remember(recent, metricSample{value: 3, timestamp: now}, now)
+	if _, ok := lastKnown.get(old); ok {
+		t.Errorf("lastKnownValues kept a sample older than maxAge")
+	}
+	if sample, ok := lastKnown.get(recent); !ok || sample.value != 3 {
+		t.Errorf("get returned %v, %v, expected 3", sample, ok)
+	}
+}
+
+func TestConfig_LastKnownFor(t *testing.T) {
+	lastKnown := func(d time.Duration) *DataPolicy {
+		return &DataPolicy{Action: MissingDataLastKnown, LastKnownFor: &metav1.Duration{Duration: d}}
+	}
+	config := &Config{
+		MissingData: lastKnown(time.Minute),
+		Metrics: []MetricConfig{
+			{ID: "net.request.count", MissingData: lastKnown(10 * time.Minute)},
+			{ID: "cpu.used.percent", MissingData: &DataPolicy{Action: MissingDataError}},
+		},
+	}
+	if have, want := config.lastKnownFor(), 10*time.Minute; have != want {
+		t.Errorf("lastKnownFor returned %s, expected %s", have, want)
+	}
+	if have, want := (&Config{}).lastKnownFor(), time.Duration(0); have != want {
+		t.Errorf("lastKnownFor returned %s without lastKnown policy, expected %s", have, want)
+	}
+}
@@ -0,0 +1,60 @@
+package cmprovider
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// NameRule advertises Sysdig metrics under a different name, so HPAs can
+// refer to a stable alias instead of the Sysdig metric ID.
+type NameRule struct {
+	// Matches is a regular expression matched against the whole Sysdig
+	// metric ID, e.g. "net\.http\.request\.time".
+	Matches string `json:"matches"`
+
+	// As is the name the metric is advertised under. It can refer to the
+	// capture groups of Matches, e.g. "http_${1}".
+	As string `json:"as"`
+
+	// HideRaw stops advertising the matched metrics under their Sysdig ID.
+	HideRaw bool `json:"hideRaw,omitempty"`
+
+	matches *regexp.Regexp
+}
+
+func (n *NameRule) complete() error {
+	if n.As == "" {
+		return fmt.Errorf("rule %q has no name to advertise metrics as", n.Matches)
+	}
+	// Anchored like the patterns of tenant policies, see
+	// compileMetricPatterns.
+	re, err := regexp.Compile("^(?:" + n.Matches + ")$")
+	if err != nil {
+		return fmt.Errorf("rule %q: %v", n.Matches, err)
+	}
+	n.matches = re
+	return nil
+}
+
+// alias returns the name the metric is advertised under by the rule.
+func (n NameRule) alias(id string) (string, bool) {
+	match := n.matches.FindStringSubmatchIndex(id)
+	if match == nil {
+		return "", false
+	}
+	return string(n.matches.ExpandString(nil, n.As, id, match)), true
+}
+
+// metricNames returns the names the Sysdig metric is advertised under. The
+// first name rule matching the metric applies.
+func (c *Config) metricNames(id string) []string {
+	for _, rule := range c.NameRules {
+		if alias, ok := rule.alias(id); ok {
+			if rule.HideRaw || alias == id {
+				return []string{alias}
+			}
+			return []string{id, alias}
+		}
+	}
+	return []string{id}
+}
@@ -0,0 +1,33 @@
+package cmprovider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfig_MetricNames(t *testing.T) {
+	config := &Config{NameRules: []NameRule{
+		{Matches: `net`, As: "network"},
+		{Matches: `net\.http\.request\.(time|count)`, As: "http_request_${1}", HideRaw: true},
+		{Matches: `^jvm\.heap\.used$`, As: "heap"},
+	}}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		// Patterns match whole IDs, not the IDs containing them.
+		{"net", []string{"net", "network"}},
+		{"net.request.count", []string{"net.request.count"}},
+		{"net.http.request.time", []string{"http_request_time"}},
+		{"net.http.request.time.max", []string{"net.http.request.time.max"}},
+		{"jvm.heap.used", []string{"jvm.heap.used", "heap"}},
+	}
+	for _, tt := range tests {
+		if have := config.metricNames(tt.id); !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("metricNames(%q) returned %v, expected %v", tt.id, have, tt.want)
+		}
+	}
+}
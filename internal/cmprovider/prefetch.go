@@ -0,0 +1,145 @@
+package cmprovider
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var hpaResource = schema.GroupVersionResource{
+	Group:    "autoscaling",
+	Version:  "v2beta1",
+	Resource: "horizontalpodautoscalers",
+}
+
+// hpaPrefetcher lists the HorizontalPodAutoscalers in the cluster and keeps
+// the values of the metrics they reference fresh in the provider cache, so
+// the HPA controller does not have to wait on Sysdig when it asks for them.
+type hpaPrefetcher struct {
+	kubeClient dynamic.ClientPool
+	provider   *sysdigProvider
+	syncPeriod time.Duration
+}
+
+func (f *hpaPrefetcher) RunUntil(stopChan <-chan struct{}) {
+	go wait.Until(func() {
+		if err := f.prefetch(); err != nil {
+			utilruntime.HandleError(err)
+		}
+	}, f.syncPeriod, stopChan)
+}
+
+// prefetchWorkers bounds the number of values fetched from Sysdig at once.
+const prefetchWorkers = 8
+
+func (f *hpaPrefetcher) prefetch() error {
+	hpas, err := f.listHPAs()
+	if err != nil {
+		return fmt.Errorf("unable to list horizontal pod autoscalers: %v", err)
+	}
+	var keys []valueKey
+	seen := make(map[valueKey]bool)
+	for _, hpa := range hpas {
+		for _, key := range f.keysFor(hpa) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	var mu sync.Mutex
+	items := make(map[valueKey]cachedValue, len(keys))
+	workqueue.Parallelize(prefetchWorkers, len(keys), func(i int) {
+		sample, err := f.provider.fetch(keys[i])
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("unable to prefetch metric %s: %v", keys[i], err))
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		items[keys[i]] = cachedValue{metricSample: sample, fetchedAt: time.Now()}
+	})
+	glog.V(4).Infof("Prefetched %d metric values for %d horizontal pod autoscalers", len(items), len(hpas))
+	f.provider.values.replace(items)
+	return nil
+}
+
+func (f *hpaPrefetcher) listHPAs() ([]autoscalingv2beta1.HorizontalPodAutoscaler, error) {
+	client, err := f.kubeClient.ClientForGroupVersionResource(hpaResource)
+	if err != nil {
+		return nil, err
+	}
+	resource := &metav1.APIResource{Name: hpaResource.Resource, Namespaced: true}
+	obj, err := client.Resource(resource, metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	list, ok := obj.(*unstructured.UnstructuredList)
+	if !ok {
+		return nil, fmt.Errorf("unexpected list type %T", obj)
+	}
+	hpas := make([]autoscalingv2beta1.HorizontalPodAutoscaler, 0, len(list.Items))
+	for _, item := range list.Items {
+		hpa := autoscalingv2beta1.HorizontalPodAutoscaler{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &hpa); err != nil {
+			utilruntime.HandleError(fmt.Errorf("unable to decode horizontal pod autoscaler %s/%s: %v", item.GetNamespace(), item.GetName(), err))
+			continue
+		}
+		hpas = append(hpas, hpa)
+	}
+	return hpas, nil
+}
+
+// keysFor returns the metric values referenced by the HPA that this adapter
+// can serve, with the keys requests for them use.
+func (f *hpaPrefetcher) keysFor(hpa autoscalingv2beta1.HorizontalPodAutoscaler) []valueKey {
+	var keys []valueKey
+	for _, spec := range hpa.Spec.Metrics {
+		switch spec.Type {
+		case autoscalingv2beta1.ObjectMetricSourceType:
+			if spec.Object == nil {
+				continue
+			}
+			query, ok := f.provider.queryFor(spec.Object.MetricName)
+			if !ok {
+				continue
+			}
+			name, workloadType := splitWorkloadName(spec.Object.Target.Name)
+			if workloadType == "" {
+				workloadType = spec.Object.Target.Kind
+			}
+			kind, ok := f.provider.config.kindByName(workloadType)
+			if !ok || !f.provider.config.serves(kind, query.metric) {
+				continue
+			}
+			keys = append(keys, keyFor(spec.Object.MetricName, kind, hpa.Namespace, name))
+		case autoscalingv2beta1.PodsMetricSourceType, autoscalingv2beta1.ExternalMetricSourceType:
+			// Pods metrics are requested by label selector and external
+			// metrics are not registered at all, neither is served yet.
+			glog.V(10).Infof("Skipping %s metric of horizontal pod autoscaler %s/%s", spec.Type, hpa.Namespace, hpa.Name)
+		}
+	}
+	return keys
+}
+
+// splitWorkloadName splits names in the "type;name" format used by HPA
+// targets into the workload name and type.
+func splitWorkloadName(name string) (string, string) {
+	parts := strings.SplitN(name, ";", 2)
+	if len(parts) > 1 {
+		return parts[1], parts[0]
+	}
+	return parts[0], ""
+}
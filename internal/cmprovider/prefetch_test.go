@@ -0,0 +1,197 @@
+package cmprovider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// testSysdig serves the value 42 for every data request, recording the
+// requests and how many were in flight at once.
+type testSysdig struct {
+	mu          sync.Mutex
+	requests    []sdc.GetDataRequest
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *testSysdig) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req sdc.GetDataRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	w.Write([]byte(`{"data": [{"t": 1500000000, "d": [42]}]}`))
+}
+
+func unstructuredObject(t *testing.T, obj interface{}) unstructured.Unstructured {
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		t.Fatalf("unable to convert %T: %v", obj, err)
+	}
+	return unstructured.Unstructured{Object: data}
+}
+
+// newTestProvider returns a provider serving net.request.count for
+// deployments, pods and nodes from the given Sysdig server, with the given
+// HPAs in the cluster.
+func newTestProvider(t *testing.T, sysdig *testSysdig, hpas ...autoscalingv2beta1.HorizontalPodAutoscaler) (*sysdigProvider, func()) {
+	server := httptest.NewServer(sysdig)
+	client := sdc.NewClient(nil, "token")
+	client.BaseURL, _ = url.Parse(server.URL + "/api/")
+
+	mapper := newTestMapper()
+	kube := &fakedynamic.FakeClientPool{}
+	kube.AddReactor("list", "horizontalpodautoscalers", func(clienttesting.Action) (bool, runtime.Object, error) {
+		list := &unstructured.UnstructuredList{}
+		for i := range hpas {
+			list.Items = append(list.Items, unstructuredObject(t, &hpas[i]))
+		}
+		return true, list, nil
+	})
+
+	config := &Config{Clusters: []string{"prod"}}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	r := &registry{config: config, mapper: mapper}
+	r.UpdateMetrics(sdc.Metrics{
+		"net.request.count": {
+			MetricType: "counter",
+			Namespaces: []string{"kubernetes.deployment", "kubernetes.pod", "kubernetes.node"},
+		},
+	})
+	return &sysdigProvider{
+		mapper:               mapper,
+		kubeClient:           kube,
+		sysdigClient:         client,
+		sysdigRequestTimeout: 5 * time.Second,
+		config:               config,
+		values:               newValueCache(time.Minute),
+		lastKnown:            newLastKnownValues(0),
+		health:               &sysdigHealth{client: client},
+		MetricsRegistry:      r,
+	}, server.Close
+}
+
+func testHPA() autoscalingv2beta1.HorizontalPodAutoscaler {
+	return autoscalingv2beta1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "shop"},
+		Spec: autoscalingv2beta1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta1.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "api"},
+			Metrics: []autoscalingv2beta1.MetricSpec{
+				{
+					Type: autoscalingv2beta1.ObjectMetricSourceType,
+					Object: &autoscalingv2beta1.ObjectMetricSource{
+						Target:     autoscalingv2beta1.CrossVersionObjectReference{Kind: "Deployment", Name: "api"},
+						MetricName: "net.request.count",
+					},
+				},
+				{
+					Type: autoscalingv2beta1.ObjectMetricSourceType,
+					Object: &autoscalingv2beta1.ObjectMetricSource{
+						Target:     autoscalingv2beta1.CrossVersionObjectReference{Kind: "Node", Name: "node-1"},
+						MetricName: "net.request.count",
+					},
+				},
+				{
+					Type: autoscalingv2beta1.PodsMetricSourceType,
+					Pods: &autoscalingv2beta1.PodsMetricSource{MetricName: "net.request.count"},
+				},
+				{
+					Type: autoscalingv2beta1.ExternalMetricSourceType,
+					External: &autoscalingv2beta1.ExternalMetricSource{
+						MetricName:     "net.request.count",
+						MetricSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"queue": "orders"}},
+					},
+				},
+				{
+					Type: autoscalingv2beta1.ObjectMetricSourceType,
+					Object: &autoscalingv2beta1.ObjectMetricSource{
+						Target:     autoscalingv2beta1.CrossVersionObjectReference{Kind: "Deployment", Name: "api"},
+						MetricName: "unknown.metric",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestHPAPrefetcher_KeysFor(t *testing.T) {
+	p, stop := newTestProvider(t, &testSysdig{})
+	defer stop()
+	f := &hpaPrefetcher{kubeClient: p.kubeClient, provider: p}
+
+	have := make(map[valueKey]bool)
+	for _, key := range f.keysFor(testHPA()) {
+		have[key] = true
+	}
+	want := []valueKey{
+		{metric: "net.request.count", namespace: "shop", name: "api", workloadType: "deployment"},
+		// Root-scoped objects are requested without namespace.
+		{metric: "net.request.count", name: "node-1", workloadType: "node"},
+		// Pods and External metrics are not served, so not prefetched.
+	}
+	if len(have) != len(want) {
+		t.Errorf("keysFor returned %v, expected %v", have, want)
+	}
+	for _, key := range want {
+		if !have[key] {
+			t.Errorf("keysFor did not return %s", key)
+		}
+	}
+}
+
+func TestHPAPrefetcher_Prefetch(t *testing.T) {
+	sysdig := &testSysdig{}
+	hpas := []autoscalingv2beta1.HorizontalPodAutoscaler{testHPA(), testHPA()}
+	hpas[1].Name = "api-copy"
+	p, stop := newTestProvider(t, sysdig, hpas...)
+	defer stop()
+	f := &hpaPrefetcher{kubeClient: p.kubeClient, provider: p}
+
+	if err := f.prefetch(); err != nil {
+		t.Fatalf("prefetch returned error: %v", err)
+	}
+	// Values referenced by both HPAs are fetched once.
+	if have, want := len(sysdig.requests), 2; have != want {
+		t.Errorf("prefetch made %d requests, expected %d", have, want)
+	}
+	if sysdig.maxInFlight > prefetchWorkers {
+		t.Errorf("prefetch made %d requests at once, expected at most %d", sysdig.maxInFlight, prefetchWorkers)
+	}
+
+	// Requests are served from the cache, root-scoped objects included.
+	value, err := p.GetRootScopedMetricByName(schema.GroupResource{Resource: "nodes"}, "node-1", "net.request.count")
+	if err != nil {
+		t.Fatalf("GetRootScopedMetricByName returned error: %v", err)
+	}
+	if have, want := value.Value.String(), "42"; have != want {
+		t.Errorf("GetRootScopedMetricByName returned %s, expected %s", have, want)
+	}
+	if have, want := len(sysdig.requests), 2; have != want {
+		t.Errorf("%d requests made after prefetching, expected %d", have-2, 0)
+	}
+}
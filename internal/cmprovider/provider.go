@@ -2,19 +2,23 @@ package cmprovider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/server/healthz"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/metrics/pkg/apis/custom_metrics"
 
@@ -29,45 +33,106 @@ type sysdigProvider struct {
 	kubeClient           dynamic.ClientPool
 	sysdigClient         *sdc.Client
 	sysdigRequestTimeout time.Duration
+	config               *Config
+
+	// Values prefetched for the metrics referenced by HPAs.
+	values *valueCache
+
+	// Last values fetched, served by the "lastKnown" missing data policy.
+	lastKnown *lastKnownValues
+
+	// Lister keeping the registry up to date.
+	lister *cachingMetricsLister
+
+	// Cached reachability of Sysdig.
+	health *sysdigHealth
 
 	MetricsRegistry
 }
 
-var Cluster = ""
+var errNoValue = errors.New("no value found in the Sysdig response")
+
+// Provider is a CustomMetricsProvider that reports its health to the API
+// server.
+type Provider interface {
+	cmaprovider.CustomMetricsProvider
+
+	// HealthChecks returns the checks to register with the API server.
+	HealthChecks() []healthz.HealthzChecker
 
-func NewSysdigProvider(mapper apimeta.RESTMapper, kubeClient dynamic.ClientPool, sysdigClient *sdc.Client, sysdigRequestTimeout time.Duration, updateInterval time.Duration, stopChan <-chan struct{}) cmaprovider.CustomMetricsProvider {
+	// ReadinessHandler serves the readiness checks under ReadinessPath.
+	ReadinessHandler() http.Handler
+
+	// MetadataHandler serves the descriptors of the advertised metrics
+	// under MetadataPath.
+	MetadataHandler() http.Handler
+}
+
+// NewSysdigProvider returns a CustomMetricsProvider backed by Sysdig. When
+// hpaSyncPeriod is non-zero, the metrics referenced by HPAs are prefetched
+// in the background at that period. When snapshotFile is set, the metric
+// list is saved to it and restored from it at startup.
+func NewSysdigProvider(mapper apimeta.RESTMapper, kubeClient dynamic.ClientPool, sysdigClient *sdc.Client, config *Config, sysdigRequestTimeout time.Duration, updateInterval time.Duration, hpaSyncPeriod time.Duration, snapshotFile string, stopChan <-chan struct{}) Provider {
+	health := &sysdigHealth{client: sysdigClient, timeout: sysdigRequestTimeout}
 	lister := &cachingMetricsLister{
+		config:               config,
+		health:               health,
 		sysdigClient:         sysdigClient,
 		sysdigRequestTimeout: sysdigRequestTimeout,
 		updateInterval:       updateInterval,
-		MetricsRegistry:      &registry{},
+		snapshotFile:         snapshotFile,
+		MetricsRegistry:      &registry{config: config, mapper: mapper},
 	}
 	lister.RunUntil(stopChan)
-	return &sysdigProvider{
+	provider := &sysdigProvider{
 		kubeClient:           kubeClient,
 		mapper:               mapper,
 		sysdigClient:         sysdigClient,
 		sysdigRequestTimeout: sysdigRequestTimeout,
-		MetricsRegistry:      lister,
+		config:               config,
+		// Prefetched values are served for up to two sync periods so a
+		// single slow round does not send every request back to Sysdig.
+		values:          newValueCache(2 * hpaSyncPeriod),
+		lastKnown:       newLastKnownValues(config.lastKnownFor()),
+		lister:          lister,
+		health:          health,
+		MetricsRegistry: lister,
+	}
+	if hpaSyncPeriod > 0 {
+		prefetcher := &hpaPrefetcher{
+			kubeClient: kubeClient,
+			provider:   provider,
+			syncPeriod: hpaSyncPeriod,
+		}
+		prefetcher.RunUntil(stopChan)
 	}
+	return provider
 }
 
-func (p *sysdigProvider) metricFor(value float64, ts time.Time, groupResource schema.GroupResource, namespace string, serviceName string, workloadType string, metricName string) (*custom_metrics.MetricValue, error) {
-	kind, err := p.mapper.KindFor(groupResource.WithVersion(""))
+// metricFor builds the value of a metric describing an object of the given
+// kind, converted to the given unit.
+func (p *sysdigProvider) metricFor(value float64, unit valueUnit, ts time.Time, kind workloadKind, namespace string, name string, metricName string) (*custom_metrics.MetricValue, error) {
+	gvk, err := p.mapper.KindFor(kind.groupResource.WithVersion(""))
 	if err != nil {
-		return nil, err
+		// The cluster may serve the resource from a different group, e.g.
+		// deployments.extensions.
+		gvk, err = p.mapper.KindFor(schema.GroupVersionResource{Resource: kind.groupResource.Resource})
+		if err != nil {
+			return nil, err
+		}
 	}
-	var (
-		quantity = *resource.NewMilliQuantity(int64(value*1000), resource.DecimalSI)
-		version  = groupResource.Group + "/" + runtime.APIVersionInternal
-	)
-	glog.V(10).Infof("Returning value %s for metric %s (version=%s, kind=%s, name=%s, namespace=%s, ts=%s, workloadType=%s)",
-		quantity.String(), metricName, version, kind.Kind, serviceName, namespace, ts.String(), workloadType)
+	quantity, err := unit.quantity(value)
+	if err != nil {
+		return nil, fmt.Errorf("metric %s: %v", metricName, err)
+	}
+	version := gvk.Group + "/" + runtime.APIVersionInternal
+	glog.V(10).Infof("Returning value %s (unit=%s) for metric %s (version=%s, kind=%s, name=%s, namespace=%s, ts=%s)",
+		quantity.String(), unit.name, metricName, version, gvk.Kind, name, namespace, ts.String())
 	return &custom_metrics.MetricValue{
 		DescribedObject: custom_metrics.ObjectReference{
-			APIVersion: groupResource.Group + "/" + runtime.APIVersionInternal,
-			Kind:       kind.Kind,
-			Name:       serviceName,
+			APIVersion: version,
+			Kind:       gvk.Kind,
+			Name:       name,
 			Namespace:  namespace,
 		},
 		MetricName: metricName,
@@ -77,34 +142,201 @@ func (p *sysdigProvider) metricFor(value float64, ts time.Time, groupResource sc
 }
 
 func (p *sysdigProvider) getSingle(info cmaprovider.CustomMetricInfo, namespace, serviceName string, workloadType string) (*custom_metrics.MetricValue, error) {
-	if _, ok := p.Metric(info.Metric); !ok {
+	query, ok := p.queryFor(info.Metric)
+	if !ok {
+		return nil, cmaprovider.NewMetricNotFoundError(info.GroupResource, info.Metric)
+	}
+	if workloadType == "" {
+		// Resolve short and singular resource names, e.g. "deployment".
+		if normalized, _, err := info.Normalized(p.mapper); err == nil {
+			info.GroupResource = normalized.GroupResource
+		}
+	}
+	kind, ok := p.config.kindFor(info.GroupResource, workloadType)
+	if !ok || !p.config.serves(kind, query.metric) {
+		return nil, cmaprovider.NewMetricNotFoundForError(info.GroupResource, info.Metric, serviceName)
+	}
+
+	sample, err := p.value(keyFor(info.Metric, kind, namespace, serviceName))
+	if err == errNoValue {
 		return nil, cmaprovider.NewMetricNotFoundError(info.GroupResource, info.Metric)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return p.metricFor(sample.value, p.config.unitOf(query.metric), sample.timestamp, kind, namespace, serviceName, info.Metric)
+}
+
+// value returns the value of a metric, prefetched or fetched from Sysdig.
+func (p *sysdigProvider) value(key valueKey) (metricSample, error) {
+	if sample, ok := p.values.get(key); ok {
+		glog.V(10).Infof("Using prefetched value for metric %s", key)
+		return sample, nil
+	}
+	return p.fetch(key)
+}
+
+// metricQuery describes how the value of an advertised metric is obtained
+// from Sysdig.
+type metricQuery struct {
+	// ID of the Sysdig metric.
+	id string
+
+	// Descriptor of the Sysdig metric.
+	metric sdc.MetricDefinition
+
+	// Whether the value is the per-second rate of a counter.
+	rate bool
+
+	// Period over which rates are computed.
+	window time.Duration
 
+	// Expression computing derived metrics.
+	derived *DerivedMetric
+
+	// Aggregation selected by the suffix of the metric name, applied over
+	// its window.
+	aggregation *aggregationSuffix
+}
+
+// perReplica returns whether the value of the query is divided by the ready
+// replicas of the workload. Aggregated variants are not: their group
+// aggregation, e.g. the max across the workload, is served as selected.
+func (c *Config) perReplica(query metricQuery) bool {
+	return query.aggregation == nil && c.metric(query.id).PerReplica
+}
+
+// queryFor returns the query that serves the given advertised metric.
+func (p *sysdigProvider) queryFor(name string) (metricQuery, bool) {
+	if metric, ok := p.Metric(name); ok {
+		query := metricQuery{id: metric.ID, metric: metric}
+		if metric.MetricType == derivedMetricType {
+			query.derived = p.config.derived[metric.ID]
+		}
+		return query, true
+	}
+	if base, suffix, ok, err := splitAggregation(name); ok || err != nil {
+		if err != nil {
+			glog.V(4).Info(err)
+			return metricQuery{}, false
+		}
+		metric, ok := p.Metric(base)
+		if !ok || metric.MetricType == derivedMetricType {
+			return metricQuery{}, false
+		}
+		suffix, err := suffix.resolve(metric)
+		if err != nil {
+			glog.V(4).Info(err)
+			return metricQuery{}, false
+		}
+		return metricQuery{id: metric.ID, metric: metric, aggregation: &suffix}, true
+	}
+	if !strings.HasSuffix(name, rateSuffix) {
+		return metricQuery{}, false
+	}
+	metric, ok := p.Metric(strings.TrimSuffix(name, rateSuffix))
+	if !ok || metric.MetricType != "counter" {
+		return metricQuery{}, false
+	}
+	config := p.config.metric(metric.ID)
+	if !config.Rate {
+		return metricQuery{}, false
+	}
+	return metricQuery{id: metric.ID, metric: metric, rate: true, window: config.window()}, true
+}
+
+// fetch returns the current value of a metric, applying the missing data
+// policy of the metric when Sysdig has no usable sample.
+func (p *sysdigProvider) fetch(key valueKey) (metricSample, error) {
+	query, ok := p.queryFor(key.metric)
+	if !ok {
+		return metricSample{}, fmt.Errorf("metric %s not registered", key.metric)
+	}
+	kind, ok := p.config.kindByName(key.workloadType)
+	if !ok {
+		return metricSample{}, fmt.Errorf("unknown workload type %q", key.workloadType)
+	}
+	if err := p.authorize(kind, key, query); err != nil {
+		return metricSample{}, err
+	}
+	policy := p.config.missingData(query.id)
+	now := time.Now()
+	sample, err := p.query(key, query)
+	if err == nil && policy.stale(sample, now) {
+		glog.V(4).Infof("Rejecting sample of metric %s from %s, older than %s", key, sample.timestamp, policy.MaxAge.Duration)
+		err = errNoValue
+	}
+	if err == nil && p.config.perReplica(query) {
+		sample, err = p.perReplica(key, sample)
+	}
+	switch err {
+	case nil:
+		if policy.keepsLastKnown() {
+			p.lastKnown.remember(key, sample, now)
+		}
+		return sample, nil
+	case errNoValue:
+		return policy.apply(key, p.lastKnown, now)
+	default:
+		return metricSample{}, err
+	}
+}
+
+// query asks Sysdig for the value of a metric. It returns errNoValue when
+// Sysdig has no sample for it.
+func (p *sysdigProvider) query(key valueKey, query metricQuery) (metricSample, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), p.sysdigRequestTimeout)
 	defer cancel()
+	kind, ok := p.config.kindByName(key.workloadType)
+	if !ok {
+		return metricSample{}, fmt.Errorf("unknown workload type %q", key.workloadType)
+	}
 	req := &sdc.GetDataRequest{Last: 10, Sampling: 10}
-	clusterFilter := "kubernetes.cluster.name='" + Cluster + "' and "
-	filter := clusterFilter + "kubernetes.namespace.name='" + namespace + "' and kubernetes.workload.name='" + serviceName + "' and kubernetes.workload.type='" + workloadType + "'"
-	req = req.
-		WithMetric(info.Metric, &sdc.MetricAggregation{Group: "avg", Time: "Avg"}).
-		WithFilter(fmt.Sprintf(filter))
+	aggregation := kind.aggregation(query.metric, p.config.perReplica(query))
+	if query.rate {
+		req = &sdc.GetDataRequest{Last: int(query.window.Seconds()), Sampling: int(sampling.Seconds())}
+		aggregation = &sdc.MetricAggregation{Group: "sum", Time: "sum"}
+	}
+	if query.aggregation != nil {
+		// A single sample aggregated over the whole window.
+		window := int(query.aggregation.window.Seconds())
+		req = &sdc.GetDataRequest{Last: window, Sampling: window}
+		aggregation = &sdc.MetricAggregation{Group: query.aggregation.group, Time: query.aggregation.time}
+	}
+	// Derived metrics get every metric in their expression in one request.
+	ids := []string{query.id}
+	if query.derived != nil {
+		ids = query.derived.metrics
+	}
+	for _, id := range ids {
+		req = req.WithMetric(id, aggregation)
+	}
+	namespace := kind.namespaceOf(key.namespace, key.name)
+	scope, err := p.scope(kind, p.config.clustersFor(namespace, query.id), key.namespace, key.name)
+	if err != nil {
+		return metricSample{}, err
+	}
+	req = req.WithFilter(p.config.restrict(scope, namespace).String())
 	payload, _, err := p.sysdigClient.Data.Get(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("sysdig client error: %v", err)
+		return metricSample{}, fmt.Errorf("sysdig client error: %v", err)
+	}
+	p.health.succeeded()
+	if query.rate {
+		return counterRate(parseSamples(payload))
 	}
-	if len(payload.Samples) == 0 {
-		return p.metricFor(0, time.Now(), info.GroupResource, namespace, serviceName, workloadType, info.Metric)
+	if query.derived != nil {
+		return query.derived.eval(payload)
 	}
 	val, err := payload.FirstValue()
 	if err != nil {
-		return nil, cmaprovider.NewMetricNotFoundError(info.GroupResource, info.Metric)
+		return metricSample{}, errNoValue
 	}
 	float, err := strconv.ParseFloat(string(val), 64)
 	if err != nil {
-		return nil, fmt.Errorf("sysdig client returned a value that cannot be parsed as a float: %v", string(val))
+		return metricSample{}, fmt.Errorf("sysdig client returned a value that cannot be parsed as a float: %v", string(val))
 	}
-	return p.metricFor(float, time.Time(payload.Samples[0].Time), info.GroupResource, namespace, serviceName, workloadType, info.Metric)
+	return metricSample{value: float, timestamp: time.Time(payload.Samples[0].Time)}, nil
 }
 
 // GetRootScopedMetricByName fetches a particular metric for a particular root-scoped object.
@@ -114,12 +346,11 @@ func (p *sysdigProvider) GetRootScopedMetricByName(groupResource schema.GroupRes
 		GroupResource: groupResource,
 		Metric:        metricName,
 		Namespaced:    false,
-		Cluster:       Cluster,
 	}
 	return p.getSingle(info, "", name, "")
 }
 
-// GetRootScopedMetricByName fetches a particular metric for a set of root-scoped objects matching the given label
+// GetRootScopedMetricBySelector fetches a particular metric for a set of root-scoped objects matching the given label
 // selector.
 func (p *sysdigProvider) GetRootScopedMetricBySelector(groupResource schema.GroupResource, selector labels.Selector, metricName string) (*custom_metrics.MetricValueList, error) {
 	glog.V(10).Infof("GetRootScopedMetricBySelector() - groupResource=%s selector=%s metricName=%s", groupResource.String(), selector.String(), metricName)
@@ -135,7 +366,6 @@ func (p *sysdigProvider) GetNamespacedMetricByName(groupResource schema.GroupRes
 		GroupResource: groupResource,
 		Metric:        metricName,
 		Namespaced:    true,
-		Cluster:       Cluster,
 	}
 	return p.getSingle(info, namespace, name, workloadType)
 }
@@ -149,23 +379,67 @@ func (p *sysdigProvider) GetNamespacedMetricBySelector(groupResource schema.Grou
 }
 
 type cachingMetricsLister struct {
+	config               *Config
+	health               *sysdigHealth
 	sysdigClient         *sdc.Client
 	sysdigRequestTimeout time.Duration
 	updateInterval       time.Duration
 
+	// File the last metric list fetched is saved to and restored from at
+	// startup, if set.
+	snapshotFile string
+
+	mu sync.RWMutex
+	// When the registry was last loaded, from Sysdig or from the snapshot.
+	loadedAt time.Time
+	// Whether the registry was loaded from the snapshot and not refreshed
+	// from Sysdig since.
+	restored bool
+
 	MetricsRegistry
 }
 
+// minRetryInterval is the delay before retrying a failed refresh of the
+// metric list. It doubles on every failure, up to the update interval.
+const minRetryInterval = 10 * time.Second
+
 func (l *cachingMetricsLister) Run() {
 	l.RunUntil(wait.NeverStop)
 }
 
+// RunUntil restores the snapshot of the metric list, if any, and refreshes
+// it from Sysdig in the background until the channel is closed.
 func (l *cachingMetricsLister) RunUntil(stopChan <-chan struct{}) {
-	go wait.Until(func() {
-		if err := l.updateMetrics(); err != nil {
+	if l.snapshotFile != "" {
+		if err := l.restoreSnapshot(); err != nil {
 			utilruntime.HandleError(err)
 		}
-	}, l.updateInterval, stopChan)
+	}
+	go func() {
+		retryInterval := minRetryInterval
+		for {
+			delay := l.updateInterval
+			if err := l.updateMetrics(); err != nil {
+				utilruntime.HandleError(err)
+				delay = retryInterval
+				retryInterval = minDuration(2*retryInterval, l.updateInterval)
+			} else {
+				retryInterval = minRetryInterval
+			}
+			select {
+			case <-stopChan:
+				return
+			case <-time.After(delay):
+			}
+		}
+	}()
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 func (l *cachingMetricsLister) updateMetrics() error {
@@ -175,10 +449,38 @@ func (l *cachingMetricsLister) updateMetrics() error {
 	if err != nil {
 		return fmt.Errorf("unable to fetch list of all available metrics: %v", err)
 	}
+	l.health.succeeded()
+	if discovery := l.config.Discovery; discovery != nil {
+		metrics, err = discovery.withData(l.sysdigClient, l.sysdigRequestTimeout, l.config, metrics)
+		if err != nil {
+			return err
+		}
+	}
 	l.UpdateMetrics(metrics)
+	now := time.Now()
+	l.loaded(now, false)
+	if l.snapshotFile != "" && len(metrics) > 0 {
+		if err := saveSnapshot(l.snapshotFile, snapshot{SavedAt: now, Metrics: metrics}); err != nil {
+			utilruntime.HandleError(err)
+		}
+	}
 	return nil
 }
 
-func SetCluster(cluster string) {
-	Cluster = cluster
+func (l *cachingMetricsLister) loaded(at time.Time, restored bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.loadedAt = at
+	l.restored = restored
+}
+
+// ready returns an error until the metric list has been loaded, either
+// from Sysdig or from the snapshot.
+func (l *cachingMetricsLister) ready() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.loadedAt.IsZero() {
+		return fmt.Errorf("metric list not loaded from Sysdig yet")
+	}
+	return nil
 }
@@ -0,0 +1,95 @@
+package cmprovider
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// quantityDigits is the number of significant digits kept when converting
+// floats to quantities, the most a float64 reliably holds.
+const quantityDigits = 15
+
+// maxSuffixScale is the largest scale of a mantissa still serialized with a
+// decimal suffix: canonical exponents are multiples of 3 up to 18.
+const maxSuffixScale = 20
+
+// maxInt64Scale is the largest power of ten that fits an int64.
+const maxInt64Scale = 18
+
+// newQuantity converts a float to a quantity in the given format. The value
+// keeps quantityDigits significant digits at any magnitude. Quantities cannot
+// be finer than 1n, so smaller digits are rounded to the nearest nano unit.
+// NaN and infinite values cannot be represented and are rejected.
+func newQuantity(value float64, format resource.Format) (resource.Quantity, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return resource.Quantity{}, fmt.Errorf("value %v cannot be represented as a quantity", value)
+	}
+	mantissa, scale := decimalDigits(value)
+
+	// Round digits finer than the nano scale away.
+	if scale < int(resource.Nano) {
+		shift := int(resource.Nano) - scale
+		if shift > quantityDigits {
+			mantissa = 0
+		} else {
+			pow := int64(math.Pow10(shift))
+			rounded := mantissa / pow
+			if rem := mantissa % pow; 2*abs(rem) >= pow {
+				if mantissa < 0 {
+					rounded--
+				} else {
+					rounded++
+				}
+			}
+			mantissa = rounded
+		}
+		scale = int(resource.Nano)
+	}
+	for mantissa != 0 && mantissa%10 == 0 {
+		mantissa /= 10
+		scale++
+	}
+	if mantissa == 0 {
+		scale = 0
+	}
+	q := resource.NewScaledQuantity(mantissa, resource.Scale(scale))
+	q.Format = quantityFormat(mantissa, scale, format)
+	return *q, nil
+}
+
+// quantityFormat returns the format a value is serialized in. Binary
+// quantities are capped at the largest int64 when parsed, and decimal
+// suffixes stop at E (10^18), so larger values use exponents instead.
+func quantityFormat(mantissa int64, scale int, format resource.Format) resource.Format {
+	if scale > maxSuffixScale {
+		return resource.DecimalExponent
+	}
+	if format == resource.BinarySI {
+		if scale < 0 || scale > maxInt64Scale || abs(mantissa) > math.MaxInt64/int64(math.Pow10(scale)) {
+			return resource.DecimalSI
+		}
+	}
+	return format
+}
+
+// decimalDigits returns the value as mantissa * 10^scale, with the mantissa
+// holding quantityDigits significant digits.
+func decimalDigits(value float64) (int64, int) {
+	// e.g. "-1.23450000000000e+07"
+	s := strconv.FormatFloat(value, 'e', quantityDigits-1, 64)
+	i := strings.IndexByte(s, 'e')
+	exp, _ := strconv.Atoi(s[i+1:])
+	mantissa, _ := strconv.ParseInt(strings.Replace(s[:i], ".", "", 1), 10, 64)
+	return mantissa, exp - (quantityDigits - 1)
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,115 @@
+package cmprovider
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"testing/quick"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// anyFloat generates finite floats across the whole float64 range, from
+// subnormals to the largest values, and floats around the nano scale.
+type anyFloat float64
+
+func (anyFloat) Generate(r *rand.Rand, size int) reflect.Value {
+	var f float64
+	switch r.Intn(3) {
+	case 0:
+		for {
+			f = math.Float64frombits(r.Uint64())
+			if !math.IsNaN(f) && !math.IsInf(f, 0) {
+				break
+			}
+		}
+	case 1:
+		f = r.NormFloat64() * math.Pow10(r.Intn(40)-20)
+	default:
+		f = float64(r.Int63n(1e6)) * 1e-9 * (1 + r.Float64())
+	}
+	return reflect.ValueOf(anyFloat(f))
+}
+
+// parsedValue returns the value of the quantity as served, after a
+// round trip through its serialized form.
+func parsedValue(t *testing.T, q resource.Quantity) (resource.Quantity, float64) {
+	parsed, err := resource.ParseQuantity(q.String())
+	if err != nil {
+		t.Fatalf("ParseQuantity(%s) returned error: %v", q.String(), err)
+	}
+	value, err := strconv.ParseFloat(parsed.AsDec().String(), 64)
+	if err != nil {
+		t.Fatalf("unable to parse %s: %v", parsed.AsDec(), err)
+	}
+	return parsed, value
+}
+
+func TestNewQuantity_Properties(t *testing.T) {
+	for _, format := range []resource.Format{resource.DecimalSI, resource.BinarySI} {
+		property := func(f anyFloat) bool {
+			value := float64(f)
+			q, err := newQuantity(value, format)
+			if err != nil {
+				t.Errorf("newQuantity(%v) returned error: %v", value, err)
+				return false
+			}
+			parsed, have := parsedValue(t, q)
+			if parsed.Cmp(q) != 0 {
+				t.Errorf("newQuantity(%v) returned %s, which parses as %s", value, q.String(), parsed.String())
+				return false
+			}
+			// Up to quantityDigits significant digits, then rounded to 1n.
+			tolerance := math.Abs(value)*1e-14 + 5.000001e-10
+			if math.Abs(have-value) > tolerance {
+				t.Errorf("newQuantity(%v) returned %s, off by %v", value, q.String(), have-value)
+				return false
+			}
+			if have != 0 && math.Signbit(have) != math.Signbit(value) {
+				t.Errorf("newQuantity(%v) returned %s, with the wrong sign", value, q.String())
+				return false
+			}
+			return true
+		}
+		if err := quick.Check(property, &quick.Config{MaxCount: 20000}); err != nil {
+			t.Errorf("format %s: %v", format, err)
+		}
+	}
+}
+
+func TestNewQuantity(t *testing.T) {
+	tests := []struct {
+		value  float64
+		format resource.Format
+		want   string
+	}{
+		{0, resource.DecimalSI, "0"},
+		{0.25, resource.DecimalSI, "250m"},
+		{0.0004, resource.DecimalSI, "400u"},
+		{1.5e-9, resource.DecimalSI, "2n"},
+		{-4e-10, resource.DecimalSI, "0"},
+		{5e-324, resource.DecimalSI, "0"},
+		{2048, resource.BinarySI, "2Ki"},
+		{1.5, resource.BinarySI, "1500m"},
+		{1e19, resource.BinarySI, "10E"},
+		{1.5e300, resource.DecimalSI, "1500e297"},
+		{-math.MaxFloat64, resource.DecimalSI, "-179769313486232e294"},
+	}
+	for _, tt := range tests {
+		q, err := newQuantity(tt.value, tt.format)
+		if err != nil {
+			t.Errorf("newQuantity(%v) returned error: %v", tt.value, err)
+			continue
+		}
+		if have, want := q.String(), tt.want; have != want {
+			t.Errorf("newQuantity(%v) returned %s, expected %s", tt.value, have, want)
+		}
+	}
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := newQuantity(value, resource.DecimalSI); err == nil {
+			t.Errorf("newQuantity(%v) returned no error", value)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package cmprovider
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// sampling is the finest resolution of the Sysdig data API.
+const sampling = 10 * time.Second
+
+// rateSuffix is appended to the name of counter metrics advertised as a
+// per-second rate.
+const rateSuffix = ".rate"
+
+// parseSamples returns the first value of every time sample in the payload,
+// skipping samples without a numeric value.
+func parseSamples(payload *sdc.GetDataResponse) []metricSample {
+	samples := make([]metricSample, 0, len(payload.Samples))
+	for _, item := range payload.Samples {
+		if len(item.Values) < 1 {
+			continue
+		}
+		value, err := strconv.ParseFloat(string(item.Values[0]), 64)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, metricSample{value: value, timestamp: time.Time(item.Time)})
+	}
+	return samples
+}
+
+// counterRate computes the per-second rate of a counter from its samples.
+// Sysdig counter samples are the count of their sampling interval, so the
+// rate is their sum divided by the intervals they cover. Sysdig data lags, so
+// the latest intervals of the window are often missing and are left out.
+func counterRate(samples []metricSample) (metricSample, error) {
+	if len(samples) == 0 {
+		return metricSample{}, errNoValue
+	}
+	var count float64
+	var latest time.Time
+	for _, sample := range samples {
+		count += sample.value
+		if sample.timestamp.After(latest) {
+			latest = sample.timestamp
+		}
+	}
+	covered := time.Duration(len(samples)) * sampling
+	return metricSample{value: count / covered.Seconds(), timestamp: latest}, nil
+}
@@ -0,0 +1,75 @@
+package cmprovider
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func samplesAt(start time.Time, values ...float64) []metricSample {
+	samples := make([]metricSample, len(values))
+	for i, v := range values {
+		samples[i] = metricSample{value: v, timestamp: start.Add(time.Duration(i) * sampling)}
+	}
+	return samples
+}
+
+func TestCounterRate(t *testing.T) {
+	start := time.Unix(1523864330, 0)
+	tests := []struct {
+		name    string
+		samples []metricSample
+		want    float64
+	}{
+		{"steady", samplesAt(start, 10, 10, 10, 10, 10, 10), 1},
+		{"idle", samplesAt(start, 0, 0, 0), 0},
+		// Samples are counts per interval, so they never decrease on resets.
+		{"bursts", samplesAt(start, 100, 0, 5, 15), 3},
+		// The latest samples of a one minute window have not arrived yet,
+		// only the intervals returned are counted.
+		{"lagging", samplesAt(start, 10, 10, 10, 10, 10), 1},
+		{"unordered", []metricSample{samplesAt(start, 0, 20)[1], samplesAt(start, 0, 20)[0]}, 1},
+	}
+	for _, tt := range tests {
+		sample, err := counterRate(tt.samples)
+		if err != nil {
+			t.Errorf("%s: counterRate returned error: %v", tt.name, err)
+			continue
+		}
+		if have, want := sample.value, tt.want; have != want {
+			t.Errorf("%s: counterRate returned %v, expected %v", tt.name, have, want)
+		}
+		for _, s := range tt.samples {
+			if sample.timestamp.Before(s.timestamp) {
+				t.Errorf("%s: counterRate returned timestamp %v, expected the latest sample", tt.name, sample.timestamp)
+			}
+		}
+	}
+}
+
+func TestCounterRate_NoSamples(t *testing.T) {
+	if _, err := counterRate(nil); err != errNoValue {
+		t.Errorf("counterRate returned %v, expected %v", err, errNoValue)
+	}
+}
+
+func TestConfig_RateWindow(t *testing.T) {
+	tests := []struct {
+		window time.Duration
+		valid  bool
+	}{
+		{10 * time.Second, true},
+		{time.Minute, true},
+		{90 * time.Second, true},
+		{5 * time.Second, false},
+		{25 * time.Second, false},
+		{time.Minute + time.Second, false},
+	}
+	for _, tt := range tests {
+		config := &Config{Metrics: []MetricConfig{{ID: "net.request.count", Rate: true, Window: &metav1.Duration{Duration: tt.window}}}}
+		if err := config.complete(); (err == nil) != tt.valid {
+			t.Errorf("complete returned %v for window %s, expected valid=%v", err, tt.window, tt.valid)
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package cmprovider
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/golang/glog"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 
 	// TODO: Vendor this
 	cmaprovider "github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/custom-metrics-apiserver/pkg/provider"
@@ -16,40 +17,41 @@ type MetricsRegistry interface {
 	UpdateMetrics(sdc.Metrics)
 	Metric(name string) (metric sdc.MetricDefinition, found bool)
 	ListAllMetrics() []cmaprovider.CustomMetricInfo
+
+	// Definitions returns the registered metrics by the name they are
+	// registered under.
+	Definitions() map[string]sdc.MetricDefinition
+
+	// Advertised returns how the metric registered under the given name is
+	// advertised, including its rate and aggregation variants.
+	Advertised(name string) []cmaprovider.CustomMetricInfo
 }
 
 type registry struct {
 	mu sync.RWMutex
 
-	// Map of metrics indexed by its names, e.g. net.http.request.count.
+	config *Config
+
+	// Mapper used to advertise metrics under the resources actually served
+	// by the cluster.
+	mapper apimeta.RESTMapper
+
+	// Map of metrics indexed by the names they are advertised under, e.g.
+	// net.http.request.count or an alias given by a name rule.
 	defs map[string]sdc.MetricDefinition
 
 	// List metrics that we return to Kubernetes.
 	metrics []cmaprovider.CustomMetricInfo
-}
 
-var _ MetricsRegistry = &registry{}
+	// Metrics returned to Kubernetes, by the name of their definition.
+	advertised map[string][]cmaprovider.CustomMetricInfo
 
-var acceptedSysdigMetricNamespaces = []string{
-	"kubernetes.cluster",
-	"kubernetes.namespace",
-	"kubernetes.deployment",
-	"kubernetes.job",
-	"kubernetes.daemonSet",
-	"kubernetes.service",
-	"kubernetes.node",
-	"kubernetes.replicaSet",
-	"kubernetes.pod",
+	// Last changes of the registry filter logged.
+	reported   bool
+	lastReport string
 }
 
-func wantedNamespace(n string) bool {
-	for _, wanted := range acceptedSysdigMetricNamespaces {
-		if wanted == n {
-			return true
-		}
-	}
-	return false
-}
+var _ MetricsRegistry = &registry{}
 
 func hasNamespace(namespaces []string, wanted string) bool {
 	for _, item := range namespaces {
@@ -61,30 +63,97 @@ func hasNamespace(namespaces []string, wanted string) bool {
 }
 
 func (r *registry) UpdateMetrics(m sdc.Metrics) {
+	r.logReport(m)
+	// Sorted, so conflicting names are resolved the same way every time.
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
 	newDefs := make(map[string]sdc.MetricDefinition)
-	for name, metric := range m {
-		// Ignore non-quantifiable metrics.
-		if metric.MetricType != "gauge" && metric.MetricType != "counter" {
+	for _, id := range ids {
+		metric := m[id]
+		if metric.ID == "" {
+			metric.ID = id
+		}
+		if !r.config.advertisable(metric) {
 			continue
 		}
-		// Only services for now.
-		if hasNamespace(metric.Namespaces, "kubernetes.deployment") ||
-			hasNamespace(metric.Namespaces, "kubernetes.statefulSet") {
+		for _, name := range r.config.metricNames(id) {
+			// Sysdig IDs can contain characters that cannot be served,
+			// e.g. the colons of Prometheus metrics.
+			name = cmaprovider.EncodeMetricName(name)
+			if other, ok := newDefs[name]; ok {
+				glog.Errorf("metric %s advertised as %s, which is already taken by metric %s", id, name, other.ID)
+				continue
+			}
 			newDefs[name] = metric
 		}
 	}
+	for i := range r.config.DerivedMetrics {
+		derived := &r.config.DerivedMetrics[i]
+		metric, ok := derived.definition(m)
+		if !ok {
+			glog.V(4).Infof("derived metric %s uses unknown metrics", derived.Name)
+			continue
+		}
+		name := cmaprovider.EncodeMetricName(derived.Name)
+		if other, ok := newDefs[name]; ok {
+			glog.Errorf("derived metric %s is already taken by metric %s", derived.Name, other.ID)
+			continue
+		}
+		newDefs[name] = metric
+	}
 	newMetrics := make([]cmaprovider.CustomMetricInfo, 0, len(newDefs))
-	for name := range newDefs {
-		newMetrics = append(newMetrics, cmaprovider.CustomMetricInfo{
-			GroupResource: schema.GroupResource{Resource: "Workload"},
-			Metric:        name,
-			Namespaced:    true,
-		})
+	newAdvertised := make(map[string][]cmaprovider.CustomMetricInfo, len(newDefs))
+	for name, metric := range newDefs {
+		names := []string{name}
+		// Counters can also be advertised as a per-second rate.
+		if metric.MetricType == "counter" && r.config.metric(metric.ID).Rate {
+			names = append(names, name+rateSuffix)
+		}
+		// Variants selecting an aggregation, e.g. net.http.request.time:p95:1m.
+		if metric.MetricType != derivedMetricType {
+			for _, suffix := range aggregationVariants(metric, r.config.aggregationWindows()) {
+				names = append(names, name+suffix.String())
+			}
+		}
+		infos := r.metricInfos(metric, names)
+		newAdvertised[name] = infos
+		newMetrics = append(newMetrics, infos...)
 	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.defs = newDefs
 	r.metrics = newMetrics
+	r.advertised = newAdvertised
+}
+
+// metricInfos returns how the given names of the metric are advertised: once
+// per resource of the kinds the metric is available for. Resources are
+// normalized with the REST mapper, so those not served by the cluster are
+// left out.
+func (r *registry) metricInfos(metric sdc.MetricDefinition, names []string) []cmaprovider.CustomMetricInfo {
+	var infos []cmaprovider.CustomMetricInfo
+	for _, kind := range r.config.supportedKinds(metric) {
+		info := cmaprovider.CustomMetricInfo{
+			GroupResource: kind.groupResource,
+			Namespaced:    kind.namespaced,
+		}
+		if r.mapper != nil {
+			normalized, _, err := info.Normalized(r.mapper)
+			if err != nil {
+				glog.V(10).Infof("resource %s not served by the cluster: %v", info.GroupResource, err)
+				continue
+			}
+			info = normalized
+		}
+		for _, name := range names {
+			info.Metric = name
+			infos = append(infos, info)
+		}
+	}
+	return infos
 }
 
 func (r *registry) Metric(name string) (sdc.MetricDefinition, bool) {
@@ -103,3 +172,15 @@ func (r *registry) ListAllMetrics() []cmaprovider.CustomMetricInfo {
 	defer r.mu.RUnlock()
 	return r.metrics
 }
+
+func (r *registry) Definitions() map[string]sdc.MetricDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defs
+}
+
+func (r *registry) Advertised(name string) []cmaprovider.CustomMetricInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.advertised[name]
+}
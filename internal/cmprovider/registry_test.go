@@ -0,0 +1,178 @@
+package cmprovider
+
+import (
+	"sort"
+	"testing"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func newTestMapper() apimeta.RESTMapper {
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{
+		{Version: "v1"},
+		{Group: "apps", Version: "v1"},
+	}, apimeta.InterfacesForUnstructured)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, apimeta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}, apimeta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, apimeta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Node"}, apimeta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, apimeta.RESTScopeRoot)
+	return mapper
+}
+
+func advertised(r MetricsRegistry) []string {
+	var names []string
+	for _, info := range r.ListAllMetrics() {
+		names = append(names, info.String())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRegistry_UpdateMetrics(t *testing.T) {
+	r := &registry{config: &Config{}, mapper: newTestMapper()}
+	r.UpdateMetrics(sdc.Metrics{
+		"net.request.count": {
+			ID:         "net.request.count",
+			MetricType: "counter",
+			Namespaces: []string{"kubernetes.cluster", "kubernetes.namespace", "kubernetes.deployment", "kubernetes.daemonSet", "kubernetes.node"},
+		},
+		"kubernetes.service.name": {
+			ID:         "kubernetes.service.name",
+			MetricType: "none",
+			Namespaces: []string{"kubernetes.service"},
+		},
+		"host.count": {
+			ID:         "host.count",
+			MetricType: "gauge",
+			Namespaces: []string{"kubernetes.cluster"},
+		},
+	})
+
+	// daemonsets are not served by the test mapper.
+	want := []string{
+		"deployments.apps/net.request.count(namespaced)",
+		"namespaces/net.request.count",
+		"nodes/net.request.count",
+	}
+	have := advertised(r)
+	if len(have) != len(want) {
+		t.Fatalf("ListAllMetrics returned %v, expected %v", have, want)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("ListAllMetrics returned %v, expected %v", have, want)
+		}
+	}
+	if _, ok := r.Metric("host.count"); ok {
+		t.Errorf("Metric returned host.count, which is not available for any kind")
+	}
+}
+
+func TestRegistry_NameRules(t *testing.T) {
+	config := &Config{NameRules: []NameRule{
+		{Matches: `^net\.http\.request\.(time|count)$`, As: "http_request_${1}", HideRaw: true},
+		{Matches: `^cpu\.used\.percent$`, As: "cpu"},
+	}}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	r := &registry{config: config, mapper: newTestMapper()}
+	namespaces := []string{"kubernetes.deployment"}
+	r.UpdateMetrics(sdc.Metrics{
+		"net.http.request.time": {MetricType: "gauge", Namespaces: namespaces},
+		"cpu.used.percent":      {MetricType: "gauge", Namespaces: namespaces},
+	})
+
+	want := []string{
+		"deployments.apps/cpu(namespaced)",
+		"deployments.apps/cpu.used.percent(namespaced)",
+		"deployments.apps/http_request_time(namespaced)",
+	}
+	have := advertised(r)
+	if len(have) != len(want) {
+		t.Fatalf("ListAllMetrics returned %v, expected %v", have, want)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("ListAllMetrics returned %v, expected %v", have, want)
+		}
+	}
+	if metric, ok := r.Metric("http_request_time"); !ok || metric.ID != "net.http.request.time" {
+		t.Errorf("Metric(http_request_time) returned %v, expected net.http.request.time", metric.ID)
+	}
+	if _, ok := r.Metric("net.http.request.time"); ok {
+		t.Errorf("Metric returned net.http.request.time, which is hidden")
+	}
+}
+
+func TestRegistry_AggregationVariants(t *testing.T) {
+	config := &Config{}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	r := &registry{config: config, mapper: newTestMapper()}
+	r.UpdateMetrics(sdc.Metrics{
+		"net.http.request.time": {
+			MetricType:        "gauge",
+			Namespaces:        []string{"kubernetes.deployment"},
+			TimeAggregations:  []string{"avg", "timeAvg", "p95"},
+			GroupAggregations: []string{"avg", "p95"},
+		},
+	})
+
+	want := []string{
+		"deployments.apps/net.http.request.time(namespaced)",
+		"deployments.apps/net.http.request.time:avg:1m(namespaced)",
+		"deployments.apps/net.http.request.time:p95:1m(namespaced)",
+	}
+	have := advertised(r)
+	if len(have) != len(want) {
+		t.Fatalf("ListAllMetrics returned %v, expected %v", have, want)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("ListAllMetrics returned %v, expected %v", have, want)
+		}
+	}
+}
+
+func TestRegistry_EncodedNames(t *testing.T) {
+	config := &Config{}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	r := &registry{config: config, mapper: newTestMapper()}
+	r.UpdateMetrics(sdc.Metrics{
+		"rabbitmq:Queue_messages": {
+			MetricType:        "gauge",
+			Namespaces:        []string{"kubernetes.deployment"},
+			TimeAggregations:  []string{"avg"},
+			GroupAggregations: []string{"avg"},
+		},
+	})
+	want := []string{
+		"deployments.apps/rabbitmq~3a~51ueue_messages(namespaced)",
+		"deployments.apps/rabbitmq~3a~51ueue_messages:avg:1m(namespaced)",
+	}
+	have := advertised(r)
+	if len(have) != len(want) {
+		t.Fatalf("ListAllMetrics returned %v, expected %v", have, want)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("ListAllMetrics returned %v, expected %v", have, want)
+		}
+	}
+	p := &sysdigProvider{config: config, MetricsRegistry: r}
+	query, ok := p.queryFor("rabbitmq~3a~51ueue_messages:avg:1m")
+	if !ok {
+		t.Fatalf("queryFor did not resolve the encoded aggregated name")
+	}
+	if have, want := query.id, "rabbitmq:Queue_messages"; have != want {
+		t.Errorf("queryFor returned metric %s, expected %s", have, want)
+	}
+}
@@ -0,0 +1,56 @@
+package cmprovider
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// readyReplicas returns the number of ready replicas of a workload, read from
+// its status.
+func (p *sysdigProvider) readyReplicas(kind workloadKind, namespace, name string) (int64, error) {
+	if !kind.countsReplicas() {
+		return 0, fmt.Errorf("%s objects do not report ready replicas", kind.name)
+	}
+	gvr, err := p.mapper.ResourceFor(kind.groupResource.WithVersion(""))
+	if err != nil {
+		return 0, err
+	}
+	client, err := p.kubeClient.ClientForGroupVersionResource(gvr)
+	if err != nil {
+		return 0, err
+	}
+	resource := &metav1.APIResource{Name: gvr.Resource, Namespaced: kind.namespaced}
+	obj, err := client.Resource(resource, namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	replicas, _, err := unstructured.NestedInt64(obj.Object, "status", kind.readyReplicasField)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read replicas of %s %s/%s: %v", kind.name, namespace, name, err)
+	}
+	return replicas, nil
+}
+
+// perReplica divides the sample, summed across the workload, by the number of
+// ready replicas of the workload. Workloads without ready replicas have no
+// value.
+func (p *sysdigProvider) perReplica(key valueKey, sample metricSample) (metricSample, error) {
+	kind, ok := p.config.kindByName(key.workloadType)
+	if !ok {
+		return metricSample{}, fmt.Errorf("unknown workload type %q", key.workloadType)
+	}
+	replicas, err := p.readyReplicas(kind, key.namespace, key.name)
+	if err != nil {
+		return metricSample{}, fmt.Errorf("unable to get ready replicas: %v", err)
+	}
+	if replicas == 0 {
+		glog.V(4).Infof("No ready replicas to divide metric %s by", key)
+		return metricSample{}, errNoValue
+	}
+	glog.V(4).Infof("Dividing metric %s value %v by %d ready replicas", key, sample.value, replicas)
+	sample.value /= float64(replicas)
+	return sample, nil
+}
@@ -0,0 +1,126 @@
+package cmprovider
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func newReplicasProvider(config *Config, readyReplicas int64) *sysdigProvider {
+	client := &fakedynamic.FakeClientPool{}
+	client.AddReactor("get", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{"readyReplicas": readyReplicas},
+		}}, nil
+	})
+	return &sysdigProvider{config: config, mapper: newTestMapper(), kubeClient: client}
+}
+
+func TestSysdigProvider_PerReplica(t *testing.T) {
+	config := &Config{Metrics: []MetricConfig{{ID: "net.request.count", PerReplica: true}}}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	key := valueKey{metric: "net.request.count", namespace: "shop", name: "api", workloadType: "deployment"}
+	sample := metricSample{value: 10, timestamp: time.Unix(1500000000, 0)}
+
+	have, err := newReplicasProvider(config, 4).perReplica(key, sample)
+	if err != nil {
+		t.Fatalf("perReplica returned error: %v", err)
+	}
+	if want := 2.5; have.value != want {
+		t.Errorf("perReplica returned %v, expected %v", have.value, want)
+	}
+	if _, err := newReplicasProvider(config, 0).perReplica(key, sample); err != errNoValue {
+		t.Errorf("perReplica returned %v without ready replicas, expected errNoValue", err)
+	}
+
+	// The value divided is the sum across the workload, not its average.
+	deployment, _ := config.kindByName("deployment")
+	metric := sdc.MetricDefinition{ID: "net.request.count", MetricType: "counter"}
+	if have, want := deployment.aggregation(metric, true).Group, "sum"; have != want {
+		t.Errorf("aggregation returned group aggregation %s, expected %s", have, want)
+	}
+	if have, want := deployment.aggregation(metric, false).Group, "avg"; have != want {
+		t.Errorf("aggregation returned group aggregation %s, expected %s", have, want)
+	}
+}
+
+func TestConfig_PerReplicaKinds(t *testing.T) {
+	config := &Config{Metrics: []MetricConfig{{ID: "net.request.count", PerReplica: true}}}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	metric := sdc.MetricDefinition{
+		ID:         "net.request.count",
+		Namespaces: []string{"kubernetes.deployment", "kubernetes.daemonSet", "kubernetes.service", "kubernetes.pod", "kubernetes.node"},
+	}
+	var have []string
+	for _, kind := range config.supportedKinds(metric) {
+		have = append(have, kind.name)
+	}
+	if want := []string{"deployment", "daemonset"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("supportedKinds returned %v, expected %v", have, want)
+	}
+
+	for _, name := range []string{"job", "service", "pod", "node", "namespace"} {
+		kind, _ := config.kindByName(name)
+		if _, err := newReplicasProvider(config, 1).readyReplicas(kind, "shop", "api"); err == nil {
+			t.Errorf("readyReplicas accepted kind %s", name)
+		}
+	}
+}
+
+func TestSysdigProvider_PerReplicaVariants(t *testing.T) {
+	sysdig := &testSysdig{}
+	p, stop := newTestProvider(t, sysdig)
+	defer stop()
+	p.config.Metrics = []MetricConfig{{ID: "net.request.count", PerReplica: true}}
+	if err := p.config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	p.MetricsRegistry.(*registry).UpdateMetrics(sdc.Metrics{
+		"net.request.count": {
+			MetricType:        "counter",
+			Namespaces:        []string{"kubernetes.deployment"},
+			TimeAggregations:  []string{"avg", "max"},
+			GroupAggregations: []string{"avg", "max"},
+		},
+	})
+	p.kubeClient.(*fakedynamic.FakeClientPool).AddReactor("get", "deployments", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{"readyReplicas": int64(4)},
+		}}, nil
+	})
+	deployment, _ := p.config.kindByName("deployment")
+
+	tests := []struct {
+		metric string
+		group  string
+		want   float64
+	}{
+		{"net.request.count", "sum", 10.5},
+		// The max across the workload is not divided by its replicas.
+		{"net.request.count:max:1m", "max", 42},
+	}
+	for i, tt := range tests {
+		sample, err := p.fetch(keyFor(tt.metric, deployment, "shop", "api"))
+		if err != nil {
+			t.Errorf("fetch of %s returned error: %v", tt.metric, err)
+			continue
+		}
+		if sample.value != tt.want {
+			t.Errorf("fetch of %s returned %v, expected %v", tt.metric, sample.value, tt.want)
+		}
+		if have := sysdig.requests[i].Metrics[0].Aggregations.Group; have != tt.group {
+			t.Errorf("fetch of %s requested group aggregation %s, expected %s", tt.metric, have, tt.group)
+		}
+	}
+}
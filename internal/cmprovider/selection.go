@@ -0,0 +1,259 @@
+package cmprovider
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// RegistryFilter selects the Sysdig metrics advertised by the registry.
+// Metrics must also be available for any of the kinds the adapter can scope.
+type RegistryFilter struct {
+	// Include selects the metrics advertised, gauges and counters when
+	// empty. A metric matching any selector is included.
+	Include []MetricSelector `json:"include,omitempty"`
+
+	// Exclude hides the included metrics matching any selector.
+	Exclude []MetricSelector `json:"exclude,omitempty"`
+
+	// DryRun only logs what the rules add to or remove from the default
+	// selection, which is still advertised.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// MetricSelector matches Sysdig metrics by their descriptor. A metric must
+// match every field set, and any of the values of a field.
+type MetricSelector struct {
+	// Sysdig namespaces, e.g. kubernetes.deployment.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Sysdig categories, e.g. network.
+	Categories []string `json:"categories,omitempty"`
+
+	// Sysdig metric types, e.g. gauge or counter.
+	MetricTypes []string `json:"metricTypes,omitempty"`
+
+	// Sysdig value types, e.g. byte or relativeTime.
+	Types []string `json:"types,omitempty"`
+
+	// Hidden and Heuristic match the flags of the descriptor.
+	Hidden    *bool `json:"hidden,omitempty"`
+	Heuristic *bool `json:"heuristic,omitempty"`
+
+	// IDs lists regular expressions matched against the whole Sysdig metric
+	// ID.
+	IDs []string `json:"ids,omitempty"`
+
+	ids []*regexp.Regexp
+}
+
+// defaultInclude is the selection of metrics advertised without include
+// rules: the metrics that can be served as quantities.
+var defaultInclude = []MetricSelector{{MetricTypes: []string{"gauge", "counter"}}}
+
+// maxReportedMetrics is the number of metric IDs logged for each rule.
+const maxReportedMetrics = 20
+
+func (f *RegistryFilter) complete() error {
+	if f == nil {
+		return nil
+	}
+	for i := range f.Include {
+		if err := f.Include[i].complete(); err != nil {
+			return fmt.Errorf("include[%d]: %v", i, err)
+		}
+	}
+	for i := range f.Exclude {
+		if err := f.Exclude[i].complete(); err != nil {
+			return fmt.Errorf("exclude[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (s *MetricSelector) complete() error {
+	if len(s.Namespaces) == 0 && len(s.Categories) == 0 && len(s.MetricTypes) == 0 &&
+		len(s.Types) == 0 && s.Hidden == nil && s.Heuristic == nil && len(s.IDs) == 0 {
+		return fmt.Errorf("empty selector")
+	}
+	var err error
+	s.ids, err = compileMetricPatterns(s.IDs)
+	return err
+}
+
+func (s *MetricSelector) matches(metric sdc.MetricDefinition) bool {
+	if len(s.Namespaces) > 0 && !hasAnyNamespace(metric.Namespaces, s.Namespaces) {
+		return false
+	}
+	if len(s.Categories) > 0 && !contains(s.Categories, metric.Category) {
+		return false
+	}
+	if len(s.MetricTypes) > 0 && !contains(s.MetricTypes, metric.MetricType) {
+		return false
+	}
+	if len(s.Types) > 0 && !contains(s.Types, metric.Type) {
+		return false
+	}
+	if s.Hidden != nil && *s.Hidden != metric.Hidden {
+		return false
+	}
+	if s.Heuristic != nil && *s.Heuristic != metric.Heuristic {
+		return false
+	}
+	if len(s.ids) > 0 && !matchesAny(s.ids, metric.ID) {
+		return false
+	}
+	return true
+}
+
+func hasAnyNamespace(namespaces []string, wanted []string) bool {
+	for _, namespace := range wanted {
+		if hasNamespace(namespaces, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(res []*regexp.Regexp, id string) bool {
+	for _, re := range res {
+		if re.MatchString(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstMatch returns the index of the first selector matching the metric,
+// or -1.
+func firstMatch(selectors []MetricSelector, metric sdc.MetricDefinition) int {
+	for i := range selectors {
+		if selectors[i].matches(metric) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *RegistryFilter) include() []MetricSelector {
+	if f == nil || len(f.Include) == 0 {
+		return defaultInclude
+	}
+	return f.Include
+}
+
+// selects returns whether the rules select the metric, ignoring DryRun.
+func (f *RegistryFilter) selects(metric sdc.MetricDefinition) bool {
+	if firstMatch(f.include(), metric) < 0 {
+		return false
+	}
+	return f == nil || firstMatch(f.Exclude, metric) < 0
+}
+
+// advertisable returns whether the registry can advertise the metric: it
+// must be selected by the registry filter and available for any of the
+// kinds we can scope.
+func (c *Config) advertisable(metric sdc.MetricDefinition) bool {
+	if len(c.supportedKinds(metric)) == 0 {
+		return false
+	}
+	if c.RegistryFilter != nil && c.RegistryFilter.DryRun {
+		return (*RegistryFilter)(nil).selects(metric)
+	}
+	return c.RegistryFilter.selects(metric)
+}
+
+// filterReport describes what each rule of the registry filter adds to or
+// removes from the default selection of the given metrics. Added metrics are
+// attributed to the first include rule matching them, removed metrics to the
+// first exclude rule matching them, or to the include rules when none selects
+// them.
+func (c *Config) filterReport(metrics sdc.Metrics) []string {
+	f := c.RegistryFilter
+	added := make(map[string][]string)
+	removed := make(map[string][]string)
+	for id, metric := range metrics {
+		if metric.ID == "" {
+			metric.ID = id
+		}
+		if len(c.supportedKinds(metric)) == 0 {
+			continue
+		}
+		before := (*RegistryFilter)(nil).selects(metric)
+		after := f.selects(metric)
+		switch {
+		case after && !before:
+			rule := fmt.Sprintf("include[%d]", firstMatch(f.include(), metric))
+			added[rule] = append(added[rule], id)
+		case before && !after:
+			rule := "include"
+			if i := firstMatch(f.Exclude, metric); i >= 0 {
+				rule = fmt.Sprintf("exclude[%d]", i)
+			}
+			removed[rule] = append(removed[rule], id)
+		}
+	}
+	var lines []string
+	for _, rule := range sortedRules(added) {
+		lines = append(lines, fmt.Sprintf("registryFilter %s adds %s", rule, listMetrics(added[rule])))
+	}
+	for _, rule := range sortedRules(removed) {
+		lines = append(lines, fmt.Sprintf("registryFilter %s removes %s", rule, listMetrics(removed[rule])))
+	}
+	return lines
+}
+
+func sortedRules(byRule map[string][]string) []string {
+	rules := make([]string, 0, len(byRule))
+	for rule := range byRule {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+func listMetrics(ids []string) string {
+	sort.Strings(ids)
+	s := fmt.Sprintf("%d metrics: %s", len(ids), strings.Join(ids[:minInt(len(ids), maxReportedMetrics)], ", "))
+	if len(ids) > maxReportedMetrics {
+		s += ", ..."
+	}
+	return s
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// logReport logs what the registry filter changes in the selection of the
+// given metrics, when it differs from the last report logged.
+func (r *registry) logReport(metrics sdc.Metrics) {
+	f := r.config.RegistryFilter
+	if f == nil {
+		return
+	}
+	lines := r.config.filterReport(metrics)
+	report := strings.Join(lines, "\n")
+	if r.reported && report == r.lastReport {
+		return
+	}
+	r.reported, r.lastReport = true, report
+	prefix := ""
+	if f.DryRun {
+		prefix = "dry run: "
+	}
+	if len(lines) == 0 {
+		glog.Infof("%sregistryFilter does not change the advertised metrics", prefix)
+	}
+	for _, line := range lines {
+		glog.Infof("%s%s", prefix, line)
+	}
+}
@@ -0,0 +1,63 @@
+package cmprovider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestRegistryFilter(t *testing.T) {
+	yes := true
+	metrics := sdc.Metrics{
+		"net.request.count":       {MetricType: "counter", Category: "network", Namespaces: []string{"kubernetes.deployment"}},
+		"net.http.request.time":   {MetricType: "gauge", Category: "network", Namespaces: []string{"kubernetes.deployment"}},
+		"cpu.used.percent":        {MetricType: "gauge", Category: "cpu", Namespaces: []string{"kubernetes.deployment"}},
+		"cpu.cores.used.estimate": {MetricType: "gauge", Category: "cpu", Heuristic: true, Namespaces: []string{"kubernetes.node"}},
+		"jvm.gc.count":            {MetricType: "none", Category: "jvm", Namespaces: []string{"kubernetes.deployment"}},
+		"host.count":              {MetricType: "gauge", Category: "host", Namespaces: []string{"kubernetes.cluster"}},
+	}
+	config := &Config{RegistryFilter: &RegistryFilter{
+		Include: []MetricSelector{
+			{MetricTypes: []string{"gauge", "counter"}},
+			{Categories: []string{"jvm"}},
+		},
+		Exclude: []MetricSelector{
+			{Heuristic: &yes},
+			{IDs: []string{`net\.http\..*`}, Namespaces: []string{"kubernetes.deployment"}},
+		},
+	}}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	r := &registry{config: config, mapper: newTestMapper()}
+	r.UpdateMetrics(metrics)
+	want := []string{
+		"deployments.apps/cpu.used.percent(namespaced)",
+		"deployments.apps/jvm.gc.count(namespaced)",
+		"deployments.apps/net.request.count(namespaced)",
+	}
+	if have := advertised(r); !reflect.DeepEqual(have, want) {
+		t.Errorf("ListAllMetrics returned %v, expected %v", have, want)
+	}
+
+	wantReport := []string{
+		"registryFilter include[1] adds 1 metrics: jvm.gc.count",
+		"registryFilter exclude[0] removes 1 metrics: cpu.cores.used.estimate",
+		"registryFilter exclude[1] removes 1 metrics: net.http.request.time",
+	}
+	if have := config.filterReport(metrics); !reflect.DeepEqual(have, wantReport) {
+		t.Errorf("filterReport returned %v, expected %v", have, wantReport)
+	}
+
+	// A dry run advertises the default selection.
+	config.RegistryFilter.DryRun = true
+	r.UpdateMetrics(metrics)
+	if have := len(advertised(r)); have != 4 {
+		t.Errorf("dry run advertised %d metrics, expected the 4 gauges and counters", have)
+	}
+
+	if err := (&Config{RegistryFilter: &RegistryFilter{Exclude: []MetricSelector{{}}}}).complete(); err == nil {
+		t.Errorf("complete accepted an empty selector")
+	}
+}
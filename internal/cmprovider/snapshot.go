@@ -0,0 +1,76 @@
+package cmprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// snapshot is the last metric list fetched from Sysdig, saved so the
+// registry can be restored when Sysdig is unreachable at startup.
+type snapshot struct {
+	SavedAt time.Time   `json:"savedAt"`
+	Metrics sdc.Metrics `json:"metrics"`
+}
+
+// saveSnapshot writes the snapshot to the file. It is written to a
+// temporary file first so an interrupted write cannot corrupt it.
+func saveSnapshot(path string, s snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("unable to encode metric snapshot: %v", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("unable to save metric snapshot: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to save metric snapshot: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to save metric snapshot: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to save metric snapshot: %v", err)
+	}
+	return nil
+}
+
+// loadSnapshot reads the snapshot from the file.
+func loadSnapshot(path string) (snapshot, error) {
+	var s snapshot
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("unable to decode metric snapshot %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// restoreSnapshot loads the registry from the snapshot file. A missing file
+// is not an error, the registry is then loaded from Sysdig.
+func (l *cachingMetricsLister) restoreSnapshot() error {
+	s, err := loadSnapshot(l.snapshotFile)
+	if os.IsNotExist(err) {
+		glog.V(2).Infof("No metric snapshot at %s", l.snapshotFile)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	l.UpdateMetrics(s.Metrics)
+	l.loaded(s.SavedAt, true)
+	glog.Infof("Restored %d metrics saved at %s from %s", len(s.Metrics), s.SavedAt, l.snapshotFile)
+	return nil
+}
@@ -0,0 +1,65 @@
+package cmprovider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestCachingMetricsLister_RestoreSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.json")
+
+	newLister := func() *cachingMetricsLister {
+		return &cachingMetricsLister{
+			snapshotFile:    path,
+			MetricsRegistry: &registry{config: &Config{}, mapper: newTestMapper()},
+		}
+	}
+
+	// Nothing to restore yet.
+	l := newLister()
+	if err := l.restoreSnapshot(); err != nil {
+		t.Fatalf("restoreSnapshot returned error: %v", err)
+	}
+	if err := l.ready(); err == nil {
+		t.Errorf("ready returned no error without metrics")
+	}
+
+	savedAt := time.Date(2018, 4, 16, 10, 0, 0, 0, time.UTC)
+	metrics := sdc.Metrics{
+		"net.request.count": {ID: "net.request.count", MetricType: "counter", Namespaces: []string{"kubernetes.deployment"}},
+	}
+	if err := saveSnapshot(path, snapshot{SavedAt: savedAt, Metrics: metrics}); err != nil {
+		t.Fatalf("saveSnapshot returned error: %v", err)
+	}
+
+	l = newLister()
+	if err := l.restoreSnapshot(); err != nil {
+		t.Fatalf("restoreSnapshot returned error: %v", err)
+	}
+	if err := l.ready(); err != nil {
+		t.Errorf("ready returned error: %v", err)
+	}
+	if _, ok := l.Metric("net.request.count"); !ok {
+		t.Errorf("Metric did not return the restored metric")
+	}
+	if have, want := l.loadedAt, savedAt; !have.Equal(want) || !l.restored {
+		t.Errorf("restored registry loaded at %s (restored: %v), expected %s", have, l.restored, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newLister().restoreSnapshot(); err == nil {
+		t.Errorf("restoreSnapshot accepted a corrupt snapshot")
+	}
+}
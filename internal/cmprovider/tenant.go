@@ -0,0 +1,142 @@
+package cmprovider
+
+import (
+	"fmt"
+	"regexp"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// TenantPolicy restricts the Sysdig metrics the objects of some namespaces
+// can be described by.
+type TenantPolicy struct {
+	// Namespaces the policy applies to, all of them when empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Allow lists regular expressions matched against the whole Sysdig
+	// metric ID. When set, only the matched metrics can be queried.
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny lists regular expressions matched against the whole Sysdig
+	// metric ID. The matched metrics cannot be queried, even if allowed.
+	Deny []string `json:"deny,omitempty"`
+
+	// Scope lists Sysdig labels added to every query of the namespaces, e.g.
+	// to restrict them to the hosts of a team.
+	Scope []LabelScope `json:"scope,omitempty"`
+
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// LabelScope matches a Sysdig label having any of the given values.
+type LabelScope struct {
+	Label  string   `json:"label"`
+	Values []string `json:"values"`
+}
+
+func (t *TenantPolicy) complete() error {
+	var err error
+	if t.allow, err = compileMetricPatterns(t.Allow); err != nil {
+		return fmt.Errorf("allow: %v", err)
+	}
+	if t.deny, err = compileMetricPatterns(t.Deny); err != nil {
+		return fmt.Errorf("deny: %v", err)
+	}
+	for _, scope := range t.Scope {
+		if scope.Label == "" || len(scope.Values) == 0 {
+			return fmt.Errorf("scope needs a label and values")
+		}
+		if scope.Label == namespaceLabel {
+			return fmt.Errorf("scope cannot match label %s, queries are limited to the namespace of the object", namespaceLabel)
+		}
+	}
+	return nil
+}
+
+func compileMetricPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %v", pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func (t *TenantPolicy) matches(namespace string) bool {
+	return len(t.Namespaces) == 0 || contains(t.Namespaces, namespace)
+}
+
+// permits returns why the metric cannot be queried, or nil if it can.
+func (t *TenantPolicy) permits(id string) error {
+	for _, re := range t.deny {
+		if re.MatchString(id) {
+			return fmt.Errorf("metric %s is denied by pattern %q", id, re.String())
+		}
+	}
+	if len(t.allow) == 0 {
+		return nil
+	}
+	for _, re := range t.allow {
+		if re.MatchString(id) {
+			return nil
+		}
+	}
+	return fmt.Errorf("metric %s is not in the allowed metrics", id)
+}
+
+// restrict adds the label scopes of the policy to the filter.
+func (t *TenantPolicy) restrict(f filter) filter {
+	for _, scope := range t.Scope {
+		f = f.in(scope.Label, scope.Values)
+	}
+	return f
+}
+
+// restrict pins the filter of an object to the Kubernetes namespace it
+// belongs to, so no scope can read the metrics of another namespace, and adds
+// the label scopes of the policy of the namespace, if any.
+func (c *Config) restrict(f filter, namespace string) filter {
+	if namespace != "" && !f.matches(namespaceLabel, namespace) {
+		f = f.equals(namespaceLabel, namespace)
+	}
+	if tenant := c.tenantFor(namespace); tenant != nil {
+		f = tenant.restrict(f)
+	}
+	return f
+}
+
+// tenantFor returns the policy of the given namespace, if any. The first
+// matching policy applies.
+func (c *Config) tenantFor(namespace string) *TenantPolicy {
+	for i := range c.Tenants {
+		if c.Tenants[i].matches(namespace) {
+			return &c.Tenants[i]
+		}
+	}
+	return nil
+}
+
+// authorize checks the policy of the namespace the object belongs to lets
+// it be described by the metric, and every metric it is derived from.
+func (p *sysdigProvider) authorize(kind workloadKind, key valueKey, query metricQuery) error {
+	namespace := kind.namespaceOf(key.namespace, key.name)
+	policy := p.config.tenantFor(namespace)
+	if policy == nil {
+		return nil
+	}
+	ids := []string{query.id}
+	if query.derived != nil {
+		ids = append(ids, query.derived.metrics...)
+	}
+	for _, id := range ids {
+		if err := policy.permits(id); err != nil {
+			return apierrors.NewForbidden(kind.groupResource, key.name,
+				fmt.Errorf("namespace %q cannot query metric %s: %v", namespace, key.metric, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package cmprovider
+
+import (
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestSysdigProvider_Authorize(t *testing.T) {
+	config := &Config{
+		Tenants: []TenantPolicy{
+			{
+				Namespaces: []string{"payments"},
+				Allow:      []string{`net\.http\..*`, "cpu.used.percent"},
+				Deny:       []string{`net\.http\.error\..*`},
+			},
+			{Namespaces: []string{"shop"}},
+		},
+		DerivedMetrics: []DerivedMetric{
+			{Name: "errors_per_request", Expression: "net.http.error.count / net.http.request.count"},
+		},
+	}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	p := &sysdigProvider{config: config}
+	deployment, _ := kindByName("deployment")
+	namespace, _ := kindByName("namespace")
+
+	tests := []struct {
+		kind      workloadKind
+		namespace string
+		name      string
+		query     metricQuery
+		forbidden bool
+	}{
+		{deployment, "payments", "api", metricQuery{id: "net.http.request.count"}, false},
+		{deployment, "payments", "api", metricQuery{id: "cpu.used.percent"}, false},
+		{deployment, "payments", "api", metricQuery{id: "cpu.used.percentage"}, true},
+		{deployment, "payments", "api", metricQuery{id: "net.http.error.count"}, true},
+		{deployment, "payments", "api", metricQuery{id: "errors_per_request", derived: config.derived["errors_per_request"]}, true},
+		{namespace, "", "payments", metricQuery{id: "memory.bytes.used"}, true},
+		{deployment, "shop", "api", metricQuery{id: "memory.bytes.used"}, false},
+		{deployment, "default", "api", metricQuery{id: "net.http.error.count"}, false},
+	}
+	for _, tt := range tests {
+		key := valueKey{metric: tt.query.id, namespace: tt.namespace, name: tt.name, workloadType: tt.kind.name}
+		err := p.authorize(tt.kind, key, tt.query)
+		if have, want := apierrors.IsForbidden(err), tt.forbidden; have != want {
+			t.Errorf("authorize(%s) returned %v, expected forbidden: %v", key, err, want)
+		}
+	}
+}
+
+func TestTenantPolicy_Restrict(t *testing.T) {
+	policy := &TenantPolicy{Scope: []LabelScope{
+		{Label: "kubernetes.label.team", Values: []string{"payments"}},
+		{Label: "host.hostName", Values: []string{"a", "b"}},
+	}}
+	if err := policy.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	deployment, _ := kindByName("deployment")
+	have := policy.restrict(deployment.scope([]string{"prod"}, "payments", "api")).String()
+	want := "kubernetes.cluster.name='prod' and kubernetes.namespace.name='payments' and kubernetes.workload.name='api' and kubernetes.workload.type='deployment' and kubernetes.label.team='payments' and host.hostName in ('a', 'b')"
+	if have != want {
+		t.Errorf("restrict returned %s, expected %s", have, want)
+	}
+	if err := (&TenantPolicy{Scope: []LabelScope{{Label: "host.hostName"}}}).complete(); err == nil {
+		t.Errorf("complete accepted a scope without values")
+	}
+	if err := (&TenantPolicy{Scope: []LabelScope{{Label: namespaceLabel, Values: []string{"billing"}}}}).complete(); err == nil {
+		t.Errorf("complete accepted a scope on label %s", namespaceLabel)
+	}
+}
+
+func TestConfig_Restrict(t *testing.T) {
+	config := &Config{Tenants: []TenantPolicy{
+		{Namespaces: []string{"payments"}, Scope: []LabelScope{{Label: "kubernetes.label.team", Values: []string{"payments"}}}},
+	}}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	deployment, _ := kindByName("deployment")
+	namespace, _ := kindByName("namespace")
+	node, _ := kindByName("node")
+
+	tests := []struct {
+		scope     filter
+		namespace string
+		want      string
+	}{
+		{deployment.scope([]string{"prod"}, "payments", "api"), "payments", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='payments' and kubernetes.workload.name='api' and kubernetes.workload.type='deployment' and kubernetes.label.team='payments'"},
+		{namespace.scope([]string{"prod"}, "", "shop"), "shop", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop'"},
+		{node.scope([]string{"prod"}, "", "node-1"), "", "kubernetes.cluster.name='prod' and kubernetes.node.name='node-1'"},
+		// A scope targeting another namespace is still pinned to the
+		// namespace of the request, and matches nothing.
+		{filter{}.equals(namespaceLabel, "payments").equals("kubernetes.label.app", "api"), "shop", "kubernetes.namespace.name='payments' and kubernetes.label.app='api' and kubernetes.namespace.name='shop'"},
+		{filter{}.equals("kubernetes.label.app", "api"), "payments", "kubernetes.label.app='api' and kubernetes.namespace.name='payments' and kubernetes.label.team='payments'"},
+	}
+	for _, tt := range tests {
+		if have := config.restrict(tt.scope, tt.namespace).String(); have != tt.want {
+			t.Errorf("restrict(%s, %q) returned %s, expected %s", tt.scope, tt.namespace, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cmprovider
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// Ways percentages can be served, set with Config.PercentAs.
+const (
+	// PercentAsPercent serves percentages from 0 to 100, as Sysdig reports
+	// them.
+	PercentAsPercent = "percent"
+
+	// PercentAsFraction serves percentages as fractions from 0 to 1.
+	PercentAsFraction = "fraction"
+)
+
+// nanosecond converts the durations reported by Sysdig, in nanoseconds, to
+// seconds.
+const nanosecond = 1e-9
+
+// valueUnit describes how the values of a metric are served.
+type valueUnit struct {
+	// Name of the unit, empty for plain numbers.
+	name string
+
+	// Format of the served quantities.
+	format resource.Format
+
+	// Factor converting Sysdig values to the unit.
+	factor float64
+}
+
+func validatePercentAs(percentAs string) error {
+	switch percentAs {
+	case "", PercentAsPercent, PercentAsFraction:
+		return nil
+	default:
+		return fmt.Errorf("unknown percentAs %q, expected %s or %s", percentAs, PercentAsPercent, PercentAsFraction)
+	}
+}
+
+// unitOf returns the unit the values of the metric are served in, given by
+// the type of its descriptor. The scale of the descriptor multiplies raw
+// Sysdig values into the native unit of the type.
+func (c *Config) unitOf(metric sdc.MetricDefinition) valueUnit {
+	factor := metric.Scale
+	if factor == 0 {
+		factor = 1
+	}
+	switch metric.Type {
+	case "byte":
+		return valueUnit{name: "bytes", format: resource.BinarySI, factor: factor}
+	case "relativeTime":
+		return valueUnit{name: "seconds", format: resource.DecimalSI, factor: factor * nanosecond}
+	case "%":
+		if c.PercentAs == PercentAsFraction {
+			return valueUnit{name: "fraction", format: resource.DecimalSI, factor: factor / 100}
+		}
+		return valueUnit{name: "percent", format: resource.DecimalSI, factor: factor}
+	default:
+		return valueUnit{format: resource.DecimalSI, factor: factor}
+	}
+}
+
+// quantity converts a Sysdig value to a quantity in the unit.
+func (u valueUnit) quantity(value float64) (resource.Quantity, error) {
+	return newQuantity(value*u.factor, u.format)
+}
@@ -0,0 +1,42 @@
+package cmprovider
+
+import (
+	"testing"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestConfig_UnitOf(t *testing.T) {
+	tests := []struct {
+		percentAs string
+		metric    sdc.MetricDefinition
+		value     float64
+		unit      string
+		want      string
+	}{
+		{"", sdc.MetricDefinition{Type: "byte", Scale: 1}, 2048, "bytes", "2Ki"},
+		{"", sdc.MetricDefinition{Type: "relativeTime", Scale: 1}, 250000000, "seconds", "250m"},
+		{"", sdc.MetricDefinition{Type: "%", Scale: 1}, 42.5, "percent", "42500m"},
+		{PercentAsFraction, sdc.MetricDefinition{Type: "%", Scale: 1}, 42.5, "fraction", "425m"},
+		{"", sdc.MetricDefinition{Type: "number", Scale: 0.5}, 3, "", "1500m"},
+		{"", sdc.MetricDefinition{Type: "double"}, 3, "", "3"},
+	}
+	for _, tt := range tests {
+		config := &Config{PercentAs: tt.percentAs}
+		unit := config.unitOf(tt.metric)
+		if have, want := unit.name, tt.unit; have != want {
+			t.Errorf("unitOf(%s) returned unit %q, expected %q", tt.metric.Type, have, want)
+		}
+		quantity, err := unit.quantity(tt.value)
+		if err != nil {
+			t.Errorf("quantity(%v) of %s returned error: %v", tt.value, tt.metric.Type, err)
+			continue
+		}
+		if have, want := quantity.String(), tt.want; have != want {
+			t.Errorf("quantity(%v) of %s returned %s, expected %s", tt.value, tt.metric.Type, have, want)
+		}
+	}
+	if err := (&Config{PercentAs: "ratio"}).complete(); err == nil {
+		t.Errorf("complete accepted percentAs ratio")
+	}
+}
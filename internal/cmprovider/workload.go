@@ -0,0 +1,319 @@
+package cmprovider
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+// workloadKind describes a Kubernetes kind whose objects can be scoped in
+// Sysdig.
+type workloadKind struct {
+	// Name of the kind in the "type;name" target format, e.g. deployment.
+	name string
+
+	// Resource of the kind in the Kubernetes API.
+	groupResource schema.GroupResource
+
+	// Whether objects of the kind live in a Kubernetes namespace.
+	namespaced bool
+
+	// Sysdig namespace that metric descriptors must list to be available
+	// for the kind, e.g. kubernetes.deployment.
+	sysdigNamespace string
+
+	// Sysdig label matching the name of the object.
+	nameLabel string
+
+	// Sysdig label matching the name of the kind, only set for kinds scoped
+	// by the unified workload labels.
+	typeLabel string
+
+	// Status field holding the number of ready replicas, for kinds that
+	// report it.
+	readyReplicasField string
+
+	// Aggregation across the entities reporting the metric for an object,
+	// e.g. the containers of a pod. Averaged when empty, and when summing
+	// values of a metric that is not additive.
+	groupAggregation string
+
+	// Templates scoping the objects of the kind instead of its labels, if
+	// configured.
+	mapping *FilterMapping
+}
+
+var namespacesResource = schema.GroupResource{Resource: "namespaces"}
+
+// namespaceLabel is the Sysdig label of the Kubernetes namespace. It is only
+// ever matched by the adapter, against the namespace of the request.
+const namespaceLabel = "kubernetes.namespace.name"
+
+var workloadKinds = []workloadKind{
+	{
+		name:               "deployment",
+		groupResource:      schema.GroupResource{Group: "apps", Resource: "deployments"},
+		namespaced:         true,
+		sysdigNamespace:    "kubernetes.deployment",
+		nameLabel:          "kubernetes.workload.name",
+		typeLabel:          "kubernetes.workload.type",
+		readyReplicasField: "readyReplicas",
+	},
+	{
+		name:               "statefulset",
+		groupResource:      schema.GroupResource{Group: "apps", Resource: "statefulsets"},
+		namespaced:         true,
+		sysdigNamespace:    "kubernetes.statefulSet",
+		nameLabel:          "kubernetes.workload.name",
+		typeLabel:          "kubernetes.workload.type",
+		readyReplicasField: "readyReplicas",
+	},
+	{
+		name:               "daemonset",
+		groupResource:      schema.GroupResource{Group: "apps", Resource: "daemonsets"},
+		namespaced:         true,
+		sysdigNamespace:    "kubernetes.daemonSet",
+		nameLabel:          "kubernetes.daemonSet.name",
+		readyReplicasField: "numberReady",
+	},
+	{
+		name:               "replicaset",
+		groupResource:      schema.GroupResource{Group: "apps", Resource: "replicasets"},
+		namespaced:         true,
+		sysdigNamespace:    "kubernetes.replicaSet",
+		nameLabel:          "kubernetes.replicaSet.name",
+		readyReplicasField: "readyReplicas",
+	},
+	{
+		name:            "job",
+		groupResource:   schema.GroupResource{Group: "batch", Resource: "jobs"},
+		namespaced:      true,
+		sysdigNamespace: "kubernetes.job",
+		nameLabel:       "kubernetes.job.name",
+	},
+	{
+		name:            "service",
+		groupResource:   schema.GroupResource{Resource: "services"},
+		namespaced:      true,
+		sysdigNamespace: "kubernetes.service",
+		nameLabel:       "kubernetes.service.name",
+	},
+	{
+		name:            "pod",
+		groupResource:   schema.GroupResource{Resource: "pods"},
+		namespaced:      true,
+		sysdigNamespace: "kubernetes.pod",
+		nameLabel:       "kubernetes.pod.name",
+	},
+	{
+		name:             "namespace",
+		groupResource:    namespacesResource,
+		sysdigNamespace:  "kubernetes.namespace",
+		nameLabel:        namespaceLabel,
+		groupAggregation: "sum",
+	},
+	{
+		name:            "node",
+		groupResource:   schema.GroupResource{Resource: "nodes"},
+		sysdigNamespace: "kubernetes.node",
+		nameLabel:       "kubernetes.node.name",
+	},
+}
+
+// kindByName returns the built-in kind with the given name as used in the
+// "type;name" target format, case insensitive.
+func kindByName(name string) (workloadKind, bool) {
+	return findKind(workloadKinds, name)
+}
+
+func findKind(kinds []workloadKind, name string) (workloadKind, bool) {
+	for _, kind := range kinds {
+		if strings.EqualFold(kind.name, name) {
+			return kind, true
+		}
+	}
+	return workloadKind{}, false
+}
+
+// builtInKindForResource returns the built-in kind served by the resource
+// with the given name, in any group.
+func builtInKindForResource(resource string) (workloadKind, bool) {
+	for _, kind := range workloadKinds {
+		if kind.groupResource.Resource == resource {
+			return kind, true
+		}
+	}
+	return workloadKind{}, false
+}
+
+// kinds returns the kinds objects can be described by: the built-in kinds,
+// scoped as configured, and the kinds of the filter mappings.
+func (c *Config) kinds() []workloadKind {
+	if c.workloadKinds == nil {
+		return workloadKinds
+	}
+	return c.workloadKinds
+}
+
+// completeKinds scopes the built-in kinds as configured and adds the kinds of
+// the filter mappings of other resources.
+func (c *Config) completeKinds() error {
+	mappings := make(map[schema.GroupResource]*FilterMapping)
+	for i := range c.FilterMappings {
+		m := &c.FilterMappings[i]
+		if err := m.complete(); err != nil {
+			return fmt.Errorf("filterMappings[%d]: %v", i, err)
+		}
+		if _, ok := mappings[m.groupResource]; ok {
+			return fmt.Errorf("filterMappings[%d]: resource %s mapped more than once", i, m.Resource)
+		}
+		mappings[m.groupResource] = m
+	}
+	c.workloadKinds = nil
+	for _, kind := range workloadKinds {
+		kind = c.labeled(kind)
+		if m, ok := mappings[kind.groupResource]; ok {
+			if err := m.completeBuiltIn(); err != nil {
+				return fmt.Errorf("filterMappings: %v", err)
+			}
+			kind.mapping = m
+			delete(mappings, kind.groupResource)
+		}
+		c.workloadKinds = append(c.workloadKinds, kind)
+	}
+	for i := range c.FilterMappings {
+		m := &c.FilterMappings[i]
+		if _, ok := mappings[m.groupResource]; !ok {
+			continue
+		}
+		if err := m.completeCustom(); err != nil {
+			return fmt.Errorf("filterMappings[%d]: %v", i, err)
+		}
+		if _, ok := findKind(c.workloadKinds, m.Kind); ok {
+			return fmt.Errorf("filterMappings[%d]: kind %s mapped more than once", i, m.Kind)
+		}
+		c.workloadKinds = append(c.workloadKinds, m.kind())
+	}
+	return nil
+}
+
+// kindByName returns the kind with the given name as used in the
+// "type;name" target format, case insensitive.
+func (c *Config) kindByName(name string) (workloadKind, bool) {
+	return findKind(c.kinds(), name)
+}
+
+// kindForResource returns the kind served by the given resource. Groups are
+// not compared for built-in kinds, so that older groups serving the same
+// resource, e.g. deployments.extensions, are accepted.
+func (c *Config) kindForResource(groupResource schema.GroupResource) (workloadKind, bool) {
+	for _, kind := range c.kinds() {
+		if kind.groupResource.Resource != groupResource.Resource {
+			continue
+		}
+		if !kind.custom() || kind.groupResource.Group == groupResource.Group {
+			return kind, true
+		}
+	}
+	return workloadKind{}, false
+}
+
+// kindFor returns the kind of a described object. It is given by the
+// requested resource, unless the object was named with the deprecated
+// "type;name" format.
+func (c *Config) kindFor(groupResource schema.GroupResource, workloadType string) (workloadKind, bool) {
+	if workloadType != "" {
+		return c.kindByName(workloadType)
+	}
+	return c.kindForResource(groupResource)
+}
+
+// supportedKinds returns the kinds the metric is available for.
+func (c *Config) supportedKinds(metric sdc.MetricDefinition) []workloadKind {
+	var kinds []workloadKind
+	for _, kind := range c.kinds() {
+		if c.serves(kind, metric) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// custom returns whether the kind is not built in, but given by a filter
+// mapping.
+func (k workloadKind) custom() bool {
+	return k.mapping != nil && k.mapping.Kind != ""
+}
+
+// serves returns whether the metric is available for objects of the kind.
+// Per-replica metrics are rejected for kinds that do not report ready
+// replicas, e.g. services or pods.
+func (c *Config) serves(kind workloadKind, metric sdc.MetricDefinition) bool {
+	if !kind.supports(metric) {
+		return false
+	}
+	return !c.metric(metric.ID).PerReplica || kind.countsReplicas()
+}
+
+// countsReplicas returns whether objects of the kind report their ready
+// replicas, so their metrics can be divided by them.
+func (k workloadKind) countsReplicas() bool {
+	return k.readyReplicasField != ""
+}
+
+func (k workloadKind) supports(metric sdc.MetricDefinition) bool {
+	return hasNamespace(metric.Namespaces, k.sysdigNamespace)
+}
+
+// scope returns the Sysdig filter matching the object with the given name in
+// any of the given Sysdig clusters.
+func (k workloadKind) scope(clusters []string, namespace, name string) filter {
+	f := filter{}.in("kubernetes.cluster.name", clusters)
+	if k.namespaced {
+		f = f.equals(namespaceLabel, namespace)
+	}
+	f = f.equals(k.nameLabel, name)
+	if k.typeLabel != "" {
+		f = f.equals(k.typeLabel, k.name)
+	}
+	return f
+}
+
+// namespaceOf returns the Kubernetes namespace an object belongs to. Metrics
+// describing a namespace belong to the namespace itself.
+func (k workloadKind) namespaceOf(namespace, name string) string {
+	if k.groupResource == namespacesResource {
+		return name
+	}
+	return namespace
+}
+
+// aggregation returns how the samples of a metric are aggregated for an
+// object of the kind. Per-replica metrics are summed across the workload, as
+// they are divided by its ready replicas afterwards.
+func (k workloadKind) aggregation(metric sdc.MetricDefinition, perReplica bool) *sdc.MetricAggregation {
+	group := k.groupAggregation
+	if perReplica {
+		group = "sum"
+	} else if group == "" || group == "sum" && !additive(metric) {
+		group = "avg"
+	}
+	return &sdc.MetricAggregation{Group: group, Time: "Avg"}
+}
+
+// additive returns whether the values of a metric can be summed across
+// entities: counters, and gauges of amounts like bytes or cores. Ratios and
+// durations, e.g. cpu.used.percent or net.http.request.time, cannot.
+func additive(metric sdc.MetricDefinition) bool {
+	switch metric.Type {
+	case "%", "relativeTime", "date", "string":
+		return false
+	}
+	if strings.HasSuffix(metric.ID, ".percent") {
+		return false
+	}
+	return metric.MetricType == "counter" || metric.MetricType == "gauge"
+}
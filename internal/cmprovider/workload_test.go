@@ -0,0 +1,96 @@
+package cmprovider
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/sdc"
+)
+
+func TestConfig_KindFor(t *testing.T) {
+	config := &Config{}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	tests := []struct {
+		groupResource schema.GroupResource
+		workloadType  string
+		want          string
+	}{
+		{schema.GroupResource{Group: "apps", Resource: "deployments"}, "", "deployment"},
+		{schema.GroupResource{Group: "extensions", Resource: "deployments"}, "", "deployment"},
+		{schema.GroupResource{Group: "apps", Resource: "statefulsets"}, "", "statefulset"},
+		{schema.GroupResource{Group: "apps", Resource: "daemonsets"}, "", "daemonset"},
+		{schema.GroupResource{Group: "apps", Resource: "replicasets"}, "", "replicaset"},
+		{schema.GroupResource{Group: "batch", Resource: "jobs"}, "", "job"},
+		{schema.GroupResource{Resource: "services"}, "", "service"},
+		{schema.GroupResource{Resource: "pods"}, "", "pod"},
+		{schema.GroupResource{Resource: "namespaces"}, "", "namespace"},
+		{schema.GroupResource{Resource: "nodes"}, "", "node"},
+		// The deprecated "type;name" format overrides the resource.
+		{schema.GroupResource{Resource: "services"}, "StatefulSet", "statefulset"},
+		{schema.GroupResource{Group: "batch", Resource: "cronjobs"}, "", ""},
+		{schema.GroupResource{Resource: "services"}, "cronjob", ""},
+	}
+	for _, tt := range tests {
+		kind, ok := config.kindFor(tt.groupResource, tt.workloadType)
+		if have := kind.name; have != tt.want || ok != (tt.want != "") {
+			t.Errorf("kindFor(%s, %q) returned %q, %v, expected %q", tt.groupResource, tt.workloadType, have, ok, tt.want)
+		}
+	}
+}
+
+func TestWorkloadKind_ScopeLabels(t *testing.T) {
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{"deployment", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop' and kubernetes.workload.name='api' and kubernetes.workload.type='deployment'"},
+		{"statefulset", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop' and kubernetes.workload.name='api' and kubernetes.workload.type='statefulset'"},
+		{"daemonset", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop' and kubernetes.daemonSet.name='api'"},
+		{"replicaset", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop' and kubernetes.replicaSet.name='api'"},
+		{"job", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop' and kubernetes.job.name='api'"},
+		{"service", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop' and kubernetes.service.name='api'"},
+		{"pod", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='shop' and kubernetes.pod.name='api'"},
+		// Root-scoped kinds are not filtered by namespace.
+		{"namespace", "kubernetes.cluster.name='prod' and kubernetes.namespace.name='api'"},
+		{"node", "kubernetes.cluster.name='prod' and kubernetes.node.name='api'"},
+	}
+	for _, tt := range tests {
+		kind, ok := kindByName(tt.kind)
+		if !ok {
+			t.Errorf("kindByName(%q) found no kind", tt.kind)
+			continue
+		}
+		if have := kind.scope([]string{"prod"}, "shop", "api").String(); have != tt.want {
+			t.Errorf("scope of kind %s returned %s, expected %s", tt.kind, have, tt.want)
+		}
+	}
+}
+
+func TestConfig_SupportedKinds(t *testing.T) {
+	config := &Config{}
+	if err := config.complete(); err != nil {
+		t.Fatalf("complete returned error: %v", err)
+	}
+	tests := []struct {
+		namespaces []string
+		want       []string
+	}{
+		{[]string{"kubernetes.deployment", "kubernetes.statefulSet"}, []string{"deployment", "statefulset"}},
+		{[]string{"kubernetes.daemonSet", "kubernetes.replicaSet", "kubernetes.job"}, []string{"daemonset", "replicaset", "job"}},
+		{[]string{"kubernetes.service", "kubernetes.pod", "kubernetes.namespace", "kubernetes.node"}, []string{"service", "pod", "namespace", "node"}},
+		{[]string{"host", "container"}, nil},
+	}
+	for _, tt := range tests {
+		var have []string
+		for _, kind := range config.supportedKinds(sdc.MetricDefinition{ID: "net.request.count", Namespaces: tt.namespaces}) {
+			have = append(have, kind.name)
+		}
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("supportedKinds(%v) returned %v, expected %v", tt.namespaces, have, tt.want)
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 
 	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/custom-metrics-apiserver/pkg/provider"
@@ -59,6 +60,10 @@ func init() {
 
 type Config struct {
 	GenericConfig *genericapiserver.Config
+
+	// MetricAuthorizer additionally checks access to each metric name of the
+	// custom metrics API. Disabled when nil.
+	MetricAuthorizer authorizer.Authorizer
 }
 
 // CustomMetricsAdapterServer contains state for a Kubernetes cluster master/api server.
@@ -66,6 +71,7 @@ type CustomMetricsAdapterServer struct {
 	GenericAPIServer        *genericapiserver.GenericAPIServer
 	customMetricsProvider   provider.CustomMetricsProvider
 	externalMetricsProvider provider.ExternalMetricsProvider
+	metricAuthorizer        authorizer.Authorizer
 }
 
 type CompletedConfig interface {
@@ -74,6 +80,8 @@ type CompletedConfig interface {
 
 type completedConfig struct {
 	genericapiserver.CompletedConfig
+
+	metricAuthorizer authorizer.Authorizer
 }
 
 // Complete fills in any fields not set that are required to have valid data. It's mutating the receiver.
@@ -82,7 +90,7 @@ func (c *Config) Complete() CompletedConfig {
 		Major: "1",
 		Minor: "0",
 	}
-	return completedConfig{c.GenericConfig.Complete(nil)}
+	return completedConfig{c.GenericConfig.Complete(nil), c.MetricAuthorizer}
 }
 
 // New returns a new instance of CustomMetricsAdapterServer from the given config.
@@ -99,6 +107,7 @@ func (c completedConfig) New(name string, customMetricsProvider provider.CustomM
 		GenericAPIServer:        genericServer,
 		customMetricsProvider:   customMetricsProvider,
 		externalMetricsProvider: externalMetricsProvider,
+		metricAuthorizer:        c.metricAuthorizer,
 	}
 
 	if customMetricsProvider != nil {
@@ -62,7 +62,7 @@ func (s *CustomMetricsAdapterServer) InstallCustomMetricsAPI() error {
 }
 
 func (s *CustomMetricsAdapterServer) cmAPI(groupMeta *apimachinery.GroupMeta, groupVersion *schema.GroupVersion) *specificapi.MetricsAPIGroupVersion {
-	resourceStorage := metricstorage.NewREST(s.customMetricsProvider)
+	resourceStorage := metricstorage.NewREST(s.customMetricsProvider, s.metricAuthorizer)
 
 	return &specificapi.MetricsAPIGroupVersion{
 		DynamicStorage: resourceStorage,
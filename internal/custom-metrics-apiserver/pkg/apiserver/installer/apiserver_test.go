@@ -117,7 +117,7 @@ func handleCustomMetrics(prov provider.CustomMetricsProvider) http.Handler {
 	container := restful.NewContainer()
 	container.Router(restful.CurlyRouter{})
 	mux := container.ServeMux
-	resourceStorage := custommetricstorage.NewREST(prov)
+	resourceStorage := custommetricstorage.NewREST(prov, nil)
 	reqContextMapper := request.NewRequestContextMapper()
 	group := &MetricsAPIGroupVersion{
 		DynamicStorage: resourceStorage,
@@ -242,7 +242,7 @@ func (p *fakeCMProvider) GetRootScopedMetricBySelector(groupResource schema.Grou
 	return &trimmedValues, nil
 }
 
-func (p *fakeCMProvider) GetNamespacedMetricByName(groupResource schema.GroupResource, namespace string, name string, metricName string) (*custom_metrics.MetricValue, error) {
+func (p *fakeCMProvider) GetNamespacedMetricByName(groupResource schema.GroupResource, namespace string, name string, workloadType string, metricName string) (*custom_metrics.MetricValue, error) {
 	metricId := namespace + "/" + groupResource.String() + "/" + name + "/" + metricName
 	values, ok := p.namespacedValues[metricId]
 	if !ok {
@@ -310,6 +310,7 @@ func TestCustomMetricsAPI(t *testing.T) {
 
 		"GET at root resource leaf":        {"GET", "/" + prefix + "/" + customMetricsGroupVersion.Group + "/" + customMetricsGroupVersion.Version + "/nodes/foo", http.StatusNotFound, 0},
 		"GET at namespaced resource leaft": {"GET", "/" + prefix + "/" + customMetricsGroupVersion.Group + "/" + customMetricsGroupVersion.Version + "/namespaces/ns/pods/bar", http.StatusNotFound, 0},
+		"GET for unencoded metric name":    {"GET", "/" + prefix + "/" + customMetricsGroupVersion.Group + "/" + customMetricsGroupVersion.Version + "/nodes/foo/Some-Metric", http.StatusBadRequest, 0},
 
 		// Positive checks to make sure everything is wired correctly
 		"GET for all nodes (root)":                 {"GET", "/" + prefix + "/" + customMetricsGroupVersion.Group + "/" + customMetricsGroupVersion.Version + "/nodes/*/some-metric", http.StatusOK, totalNodesCount},
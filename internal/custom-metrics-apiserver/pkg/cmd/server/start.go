@@ -33,6 +33,10 @@ type CustomMetricsAdapterServerOptions struct {
 	Authorization  *genericoptions.DelegatingAuthorizationOptions
 	Features       *genericoptions.FeatureOptions
 
+	// AuthorizeMetricNames additionally checks access to each metric name,
+	// with the delegating authorizer.
+	AuthorizeMetricNames bool
+
 	StdOut io.Writer
 	StdErr io.Writer
 }
@@ -83,5 +87,8 @@ func (o CustomMetricsAdapterServerOptions) Config() (*apiserver.Config, error) {
 	config := &apiserver.Config{
 		GenericConfig: serverConfig,
 	}
+	if o.AuthorizeMetricNames {
+		config.MetricAuthorizer = serverConfig.Authorization.Authorizer
+	}
 	return config, nil
 }
@@ -26,6 +26,11 @@ type RegeneratingDiscoveryRESTMapper struct {
 	mu sync.RWMutex
 
 	delegate meta.RESTMapper
+
+	// When the mappings were last regenerated, and the error of the last
+	// attempt, if it failed.
+	syncedAt  time.Time
+	syncError error
 }
 
 func NewRESTMapper(discoveryClient discovery.DiscoveryInterface, versionInterfaces meta.VersionInterfacesFunc, refreshInterval time.Duration) (*RegeneratingDiscoveryRESTMapper, error) {
@@ -53,6 +58,9 @@ func (m *RegeneratingDiscoveryRESTMapper) RunUntil(stop <-chan struct{}) {
 func (m *RegeneratingDiscoveryRESTMapper) RegenerateMappings() error {
 	resources, err := discovery.GetAPIGroupResources(m.discoveryClient)
 	if err != nil {
+		m.mu.Lock()
+		m.syncError = err
+		m.mu.Unlock()
 		return err
 	}
 	newDelegate := discovery.NewRESTMapper(resources, m.versionInterfaces)
@@ -61,7 +69,21 @@ func (m *RegeneratingDiscoveryRESTMapper) RegenerateMappings() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.delegate = newDelegate
+	m.syncedAt = time.Now()
+	m.syncError = nil
+
+	return nil
+}
 
+// Synced returns an error unless the mappings were regenerated within the
+// last two refresh intervals.
+func (m *RegeneratingDiscoveryRESTMapper) Synced() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if age := time.Since(m.syncedAt); age > 2*m.refreshInterval {
+		return fmt.Errorf("REST mappings not regenerated for %s, last error: %v", age, m.syncError)
+	}
 	return nil
 }
 
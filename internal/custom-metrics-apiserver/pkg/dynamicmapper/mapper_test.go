@@ -92,3 +92,14 @@ func TestRegeneratingUpdatesMapper(t *testing.T) {
 		assert.Equal(t, schema.GroupVersionKind{Version: "v1alpha1", Kind: "Flunder", Group: "wardle"}, flundersGVK, "should have correctly fetched the kind for 'flunders.wardle' the second time")
 	}
 }
+
+func TestSynced(t *testing.T) {
+	mapper, _ := setupMapper(t, nil)
+	assert.NoError(t, mapper.Synced(), "the mapper should be synced after construction")
+
+	mapper.syncedAt = time.Now().Add(-3 * testingMapperRefreshInterval)
+	assert.Error(t, mapper.Synced(), "the mapper should not be synced after missing two refreshes")
+
+	require.NoError(t, mapper.RegenerateMappings(), "regenerating the mappings should not have yielded an error")
+	assert.NoError(t, mapper.Synced(), "the mapper should be synced after regenerating the mappings")
+}
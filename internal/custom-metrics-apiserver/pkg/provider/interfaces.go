@@ -32,7 +32,6 @@ type CustomMetricInfo struct {
 	GroupResource schema.GroupResource
 	Namespaced    bool
 	Metric        string
-	Cluster       string
 }
 
 // ExternalMetricInfo describes a metric.
@@ -91,6 +90,7 @@ type CustomMetricsProvider interface {
 	GetRootScopedMetricBySelector(groupResource schema.GroupResource, selector labels.Selector, metricName string) (*custom_metrics.MetricValueList, error)
 
 	// GetNamespacedMetricByName fetches a particular metric for a particular namespaced object.
+	// workloadType is only set when the object was named with the deprecated "type;name" format.
 	GetNamespacedMetricByName(groupResource schema.GroupResource, namespace string, name string, workloadType string, metricName string) (*custom_metrics.MetricValue, error)
 
 	// GetNamespacedMetricByName fetches a particular metric for a set of namespaced objects
@@ -0,0 +1,92 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// metricNameEscape starts the escape sequence of a byte that cannot appear
+// in metric names, followed by its value in two lowercase hex digits.
+const metricNameEscape = '~'
+
+// MetricNameSeparator separates the parts of a requested metric name, e.g. a
+// metric and the selector of a variant. Encoded names never contain it.
+const MetricNameSeparator = ":"
+
+// isMetricNameByte returns whether the byte can appear unescaped in metric
+// names, which are used as URL path segments and RBAC resource names.
+func isMetricNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-'
+}
+
+// EncodeMetricName encodes an identifier from a metrics backend, e.g. a
+// Prometheus metric with uppercase letters or colons, into a metric name that
+// can be served. Identifiers made of lowercase letters, digits, ".", "_" and
+// "-" are left unchanged, any other byte is escaped as "~" followed by two hex
+// digits, e.g. "jvm/Heap" becomes "jvm~2f~48eap".
+func EncodeMetricName(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if isMetricNameByte(c) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%c%02x", metricNameEscape, c)
+	}
+	return b.String()
+}
+
+// DecodeMetricName returns the identifier encoded by EncodeMetricName.
+func DecodeMetricName(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case isMetricNameByte(c):
+			b.WriteByte(c)
+		case c == metricNameEscape:
+			if i+2 >= len(name) {
+				return "", fmt.Errorf("metric name %q ends with an incomplete escape sequence", name)
+			}
+			hex := name[i+1 : i+3]
+			v, err := strconv.ParseUint(hex, 16, 8)
+			if err != nil || strings.ToLower(hex) != hex || isMetricNameByte(byte(v)) {
+				return "", fmt.Errorf("metric name %q has an invalid escape sequence %q", name, name[i:i+3])
+			}
+			b.WriteByte(byte(v))
+			i += 2
+		default:
+			return "", fmt.Errorf("metric name %q has the unencoded character %q", name, c)
+		}
+	}
+	return b.String(), nil
+}
+
+// ValidMetricName returns whether every part of the requested metric name,
+// split by MetricNameSeparator, is encoded.
+func ValidMetricName(name string) bool {
+	for _, part := range strings.Split(name, MetricNameSeparator) {
+		if _, err := DecodeMetricName(part); err != nil {
+			return false
+		}
+	}
+	return true
+}
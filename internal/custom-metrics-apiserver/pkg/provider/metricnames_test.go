@@ -0,0 +1,54 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeMetricName(t *testing.T) {
+	cases := map[string]string{
+		"net.http.request.count":          "net.http.request.count",
+		"http_requests_total":             "http_requests_total",
+		"jvm/Heap":                        "jvm~2f~48eap",
+		"rabbitmq:queue_messages:sum":     "rabbitmq~3aqueue_messages~3asum",
+		"statsd.api~latency":              "statsd.api~7elatency",
+		"app.requests{code=\"200\"}":      "app.requests~7bcode~3d~22200~22~7d",
+		"Catalina.GlobalRequestProcessor": "~43atalina.~47lobal~52equest~50rocessor",
+	}
+	for id, name := range cases {
+		assert.Equal(t, name, EncodeMetricName(id), "should have encoded %q", id)
+		decoded, err := DecodeMetricName(name)
+		require.NoError(t, err, "should have decoded %q", name)
+		assert.Equal(t, id, decoded, "should have decoded %q back", name)
+	}
+}
+
+func TestDecodeMetricNameRejectsInvalidNames(t *testing.T) {
+	for _, name := range []string{"Heap", "jvm:heap", "jvm~2", "jvm~zz", "jvm~2F", "jvm~61"} {
+		_, err := DecodeMetricName(name)
+		assert.Error(t, err, "should have rejected %q", name)
+	}
+}
+
+func TestValidMetricName(t *testing.T) {
+	assert.True(t, ValidMetricName("rabbitmq~3aqueue_messages:p95:1m"))
+	assert.False(t, ValidMetricName("rabbitmq:queue_messages:P95"))
+}
@@ -17,30 +17,65 @@ limitations under the License.
 package apiserver
 
 import (
+	"errors"
 	"fmt"
 	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/custom-metrics-apiserver/pkg/provider"
 	"github.com/golang/glog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/apiserver/pkg/endpoints/request"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/rest"
 	"k8s.io/metrics/pkg/apis/custom_metrics"
 	"strings"
+	"sync"
+	"time"
 )
 
+// MetricNamesResource is the virtual resource checked for every metric read
+// when per-metric authorization is enabled. The name of the checked object is
+// the name of the metric, so RBAC rules can list metrics in resourceNames.
+const MetricNamesResource = "metricnames"
+
+// MetricNamesGroup is the group of MetricNamesResource. It is not the custom
+// metrics group: reading metrics of any object requires access to every
+// resource of that group, which RBAC would extend to every metric name.
+const MetricNamesGroup = "metrics.sysdig.com"
+
+// deprecatedNameWarningInterval is the minimum interval between two warnings
+// about the deprecated "type;name" format, so clients cannot flood the logs.
+const deprecatedNameWarningInterval = 10 * time.Minute
+
 type REST struct {
 	cmProvider provider.CustomMetricsProvider
+
+	// Authorizer checking access to each metric name, if enabled.
+	metricAuthorizer authorizer.Authorizer
+
+	// Time of the last warning about the deprecated "type;name" format, and
+	// the number of requests using it since.
+	warnLock       sync.Mutex
+	lastWarning    time.Time
+	deprecatedUses int
+
+	now func() time.Time
 }
 
 var _ rest.Storage = &REST{}
 var _ rest.Lister = &REST{}
 
-func NewREST(cmProvider provider.CustomMetricsProvider) *REST {
+// NewREST returns the storage of the custom metrics API. When metricAuthorizer
+// is not nil, reading a metric also requires access to the metric name in the
+// MetricNamesResource virtual resource.
+func NewREST(cmProvider provider.CustomMetricsProvider, metricAuthorizer authorizer.Authorizer) *REST {
 	return &REST{
-		cmProvider: cmProvider,
+		cmProvider:       cmProvider,
+		metricAuthorizer: metricAuthorizer,
+		now:              time.Now,
 	}
 }
 
@@ -72,18 +107,17 @@ func (r *REST) List(ctx genericapirequest.Context, options *metainternalversion.
 			name = nameMatch
 		}
 	}
-	glog.Info("The value of name is %s", name)
-	nameSplit := strings.Split(name,";")
+	namespace := genericapirequest.NamespaceValue(ctx)
+
+	// The workload type is given by the resource in the request path. The
+	// "type;name" format is still accepted but deprecated.
 	workloadType := ""
-	if len(nameSplit) > 1 {
+	if nameSplit := strings.SplitN(name, ";", 2); len(nameSplit) > 1 {
 		workloadType = nameSplit[0]
 		name = nameSplit[1]
-	} else {
-		name = nameSplit[0]
+		r.warnDeprecatedName(namespace, workloadType, name)
 	}
 
-	namespace := genericapirequest.NamespaceValue(ctx)
-
 	requestInfo, ok := request.RequestInfoFrom(ctx)
 	if !ok {
 		return nil, fmt.Errorf("unable to get resource and metric name from request")
@@ -93,6 +127,7 @@ func (r *REST) List(ctx genericapirequest.Context, options *metainternalversion.
 	metricName := requestInfo.Subresource
 
 	groupResource := schema.ParseGroupResource(resourceRaw)
+	requestNamespace := namespace
 
 	// handle metrics describing namespaces
 	if namespace != "" && resourceRaw == "metrics" {
@@ -103,6 +138,16 @@ func (r *REST) List(ctx genericapirequest.Context, options *metainternalversion.
 		namespace = ""
 	}
 
+	// Metric names are encoded so identifiers of the metrics backend can be
+	// served, see provider.EncodeMetricName.
+	if !provider.ValidMetricName(metricName) {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("metric name %q is not encoded, request %q instead", metricName, provider.EncodeMetricName(metricName)))
+	}
+
+	if err := r.authorizeMetric(ctx, requestNamespace, metricName); err != nil {
+		return nil, err
+	}
+
 	// handle namespaced and root metrics
 	if name == "*" {
 		return r.handleWildcardOp(namespace, groupResource, selector, metricName)
@@ -136,3 +181,53 @@ func (r *REST) handleWildcardOp(namespace string, groupResource schema.GroupReso
 		return r.cmProvider.GetNamespacedMetricBySelector(groupResource, namespace, selector, metricName)
 	}
 }
+
+// authorizeMetric checks the user of the request may get the metric from the
+// MetricNamesResource virtual resource, when per-metric authorization is
+// enabled.
+func (r *REST) authorizeMetric(ctx genericapirequest.Context, namespace string, metricName string) error {
+	if r.metricAuthorizer == nil {
+		return nil
+	}
+	metricNames := schema.GroupResource{Group: MetricNamesGroup, Resource: MetricNamesResource}
+	user, ok := genericapirequest.UserFrom(ctx)
+	if !ok {
+		return apierrors.NewForbidden(metricNames, metricName, errors.New("no user in the request"))
+	}
+	attributes := authorizer.AttributesRecord{
+		User:            user,
+		Verb:            "get",
+		Namespace:       namespace,
+		APIGroup:        MetricNamesGroup,
+		Resource:        MetricNamesResource,
+		Name:            metricName,
+		ResourceRequest: true,
+	}
+	decision, reason, err := r.metricAuthorizer.Authorize(attributes)
+	if decision == authorizer.DecisionAllow {
+		return nil
+	}
+	if err != nil {
+		glog.Errorf("unable to authorize metric %s for user %s: %v", metricName, user.GetName(), err)
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("user %q cannot get metric %q", user.GetName(), metricName)
+	}
+	return apierrors.NewForbidden(metricNames, metricName, errors.New(reason))
+}
+
+// warnDeprecatedName logs that the "type;name" format is deprecated, at most
+// once per deprecatedNameWarningInterval. It returns whether it logged.
+func (r *REST) warnDeprecatedName(namespace, workloadType, name string) bool {
+	r.warnLock.Lock()
+	defer r.warnLock.Unlock()
+	r.deprecatedUses++
+	now := r.now()
+	if !r.lastWarning.IsZero() && now.Sub(r.lastWarning) < deprecatedNameWarningInterval {
+		return false
+	}
+	glog.Warningf("object name %q in namespace %q uses the deprecated \"type;name\" format, target the %s %q directly instead (%d requests used the format since the last warning)", workloadType+";"+name, namespace, workloadType, name, r.deprecatedUses)
+	r.lastWarning = now
+	r.deprecatedUses = 0
+	return true
+}
@@ -0,0 +1,126 @@
+package apiserver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/draios/kubernetes-sysdig-metrics-apiserver/internal/custom-metrics-apiserver/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+)
+
+// fakeProvider records the objects it is asked metrics for.
+type fakeProvider struct {
+	namespace    string
+	name         string
+	workloadType string
+}
+
+func (p *fakeProvider) GetRootScopedMetricByName(groupResource schema.GroupResource, name string, metricName string) (*custom_metrics.MetricValue, error) {
+	p.name = name
+	return &custom_metrics.MetricValue{MetricName: metricName}, nil
+}
+
+func (p *fakeProvider) GetRootScopedMetricBySelector(groupResource schema.GroupResource, selector labels.Selector, metricName string) (*custom_metrics.MetricValueList, error) {
+	return &custom_metrics.MetricValueList{}, nil
+}
+
+func (p *fakeProvider) GetNamespacedMetricByName(groupResource schema.GroupResource, namespace string, name string, workloadType string, metricName string) (*custom_metrics.MetricValue, error) {
+	p.namespace, p.name, p.workloadType = namespace, name, workloadType
+	return &custom_metrics.MetricValue{MetricName: metricName}, nil
+}
+
+func (p *fakeProvider) GetNamespacedMetricBySelector(groupResource schema.GroupResource, namespace string, selector labels.Selector, metricName string) (*custom_metrics.MetricValueList, error) {
+	return &custom_metrics.MetricValueList{}, nil
+}
+
+func (p *fakeProvider) ListAllMetrics() []provider.CustomMetricInfo {
+	return nil
+}
+
+// listObject lists the metric of the named object in the namespace, as the
+// list handler does for GET /namespaces/<namespace>/<resource>/<name>/<metric>.
+func listObject(r *REST, ctx genericapirequest.Context, namespace, resource, name, metricName string) error {
+	ctx = genericapirequest.WithNamespace(ctx, namespace)
+	ctx = genericapirequest.WithRequestInfo(ctx, &genericapirequest.RequestInfo{Resource: resource, Subresource: metricName})
+	_, err := r.List(ctx, &metainternalversion.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", name)})
+	return err
+}
+
+func TestREST_ListDeprecatedName(t *testing.T) {
+	p := &fakeProvider{}
+	r := NewREST(p, nil)
+
+	require.NoError(t, listObject(r, genericapirequest.NewContext(), "shop", "deployments.apps", "api", "net.request.count"))
+	assert.Equal(t, fakeProvider{namespace: "shop", name: "api"}, *p, "should have taken the workload type from the resource")
+
+	require.NoError(t, listObject(r, genericapirequest.NewContext(), "shop", "services", "deployment;api", "net.request.count"))
+	assert.Equal(t, fakeProvider{namespace: "shop", name: "api", workloadType: "deployment"}, *p, "should have split the deprecated name")
+}
+
+func TestREST_WarnDeprecatedName(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	r := NewREST(&fakeProvider{}, nil)
+	r.now = func() time.Time { return now }
+
+	assert.True(t, r.warnDeprecatedName("shop", "deployment", "api"), "should have warned the first time")
+	// Warnings are limited whatever the objects named.
+	assert.False(t, r.warnDeprecatedName("shop", "deployment", "api"), "should not have warned again")
+	assert.False(t, r.warnDeprecatedName("shop", "statefulset", "db"), "should not have warned for another object")
+
+	now = now.Add(deprecatedNameWarningInterval)
+	assert.True(t, r.warnDeprecatedName("shop", "statefulset", "db"), "should have warned after the interval")
+	assert.Equal(t, 0, r.deprecatedUses, "should have reset the uses since the last warning")
+}
+
+func TestREST_AuthorizeMetric(t *testing.T) {
+	var checked authorizer.Attributes
+	authorize := func(decision authorizer.Decision, reason string, err error) authorizer.Authorizer {
+		return authorizer.AuthorizerFunc(func(a authorizer.Attributes) (authorizer.Decision, string, error) {
+			checked = a
+			return decision, reason, err
+		})
+	}
+	ctx := genericapirequest.WithUser(genericapirequest.NewContext(), &user.DefaultInfo{Name: "hpa"})
+
+	p := &fakeProvider{}
+	r := NewREST(p, authorize(authorizer.DecisionAllow, "", nil))
+	require.NoError(t, listObject(r, ctx, "shop", "deployments.apps", "api", "net.request.count"))
+	assert.Equal(t, "api", p.name, "should have fetched the metric")
+	assert.Equal(t, authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "hpa"},
+		Verb:            "get",
+		Namespace:       "shop",
+		APIGroup:        MetricNamesGroup,
+		Resource:        MetricNamesResource,
+		Name:            "net.request.count",
+		ResourceRequest: true,
+	}, checked, "should have checked the metric name")
+
+	cases := map[string]authorizer.Authorizer{
+		"denied": authorize(authorizer.DecisionDeny, "not listed", nil),
+		"error":  authorize(authorizer.DecisionNoOpinion, "", errors.New("timeout")),
+	}
+	for name, a := range cases {
+		p := &fakeProvider{}
+		err := listObject(NewREST(p, a), ctx, "shop", "deployments.apps", "api", "net.request.count")
+		assert.True(t, apierrors.IsForbidden(err), "%s: should have been forbidden, got %v", name, err)
+		assert.Empty(t, p.name, "%s: should not have fetched the metric", name)
+	}
+
+	// Requests without user are denied without asking the authorizer.
+	checked = nil
+	err := listObject(r, genericapirequest.NewContext(), "shop", "deployments.apps", "api", "net.request.count")
+	assert.True(t, apierrors.IsForbidden(err), "should have been forbidden, got %v", err)
+	assert.Nil(t, checked, "should not have asked the authorizer")
+}
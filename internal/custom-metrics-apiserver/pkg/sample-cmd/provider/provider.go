@@ -208,7 +208,7 @@ func (p *testingProvider) GetRootScopedMetricBySelector(groupResource schema.Gro
 	return p.metricsFor(totalValue, groupResource, metricName, matchingObjectsRaw)
 }
 
-func (p *testingProvider) GetNamespacedMetricByName(groupResource schema.GroupResource, namespace string, name string, metricName string) (*custom_metrics.MetricValue, error) {
+func (p *testingProvider) GetNamespacedMetricByName(groupResource schema.GroupResource, namespace string, name string, workloadType string, metricName string) (*custom_metrics.MetricValue, error) {
 	value, err := p.valueFor(groupResource, metricName, true)
 	if err != nil {
 		return nil, err
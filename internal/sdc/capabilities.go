@@ -0,0 +1,63 @@
+package sdc
+
+import (
+	"context"
+	"net/http"
+)
+
+// Capabilities are the optional endpoints supported by a Sysdig backend.
+// Older on-prem releases lack some of them.
+type Capabilities struct {
+	// MetricDescriptors is set when metrics can be listed with
+	// v2/metrics/descriptors. Otherwise they are listed in the legacy format
+	// of data/metrics.
+	MetricDescriptors bool
+}
+
+const metricDescriptorsPath = "v2/metrics/descriptors"
+
+// DetectCapabilities probes the endpoints supported by the backend and
+// remembers them for later requests. Endpoints are considered missing when
+// the backend answers 404 Not Found.
+func (c *Client) DetectCapabilities(ctx context.Context) (Capabilities, error) {
+	caps := Capabilities{}
+	supported, err := c.supports(ctx, metricDescriptorsPath+"?limit=1&offset=0")
+	if err != nil {
+		return caps, err
+	}
+	caps.MetricDescriptors = supported
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capabilities = &caps
+	return caps, nil
+}
+
+// Capabilities returns the capabilities of the backend, detecting them
+// unless already known.
+func (c *Client) Capabilities(ctx context.Context) (Capabilities, error) {
+	c.mu.Lock()
+	caps := c.capabilities
+	c.mu.Unlock()
+	if caps != nil {
+		return *caps, nil
+	}
+	return c.DetectCapabilities(ctx)
+}
+
+// supports returns whether a GET request to the path succeeds, or false when
+// the endpoint is not found.
+func (c *Client) supports(ctx context.Context, path string) (bool, error) {
+	req, err := c.NewRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.Do(ctx, req, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
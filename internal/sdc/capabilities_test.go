@@ -0,0 +1,97 @@
+package sdc
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var probes int
+	mux.HandleFunc("/v2/metrics/descriptors", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		probes++
+		fmt.Fprint(w, `{"total": 0, "offset": 0, "metricDescriptors": []}`)
+	})
+
+	caps, err := client.Capabilities(ctx)
+	if err != nil {
+		t.Fatalf("Capabilities returned error: %v", err)
+	}
+	if !caps.MetricDescriptors {
+		t.Errorf("Capabilities returned %+v, expected metric descriptors", caps)
+	}
+	if _, err := client.Capabilities(ctx); err != nil || probes != 1 {
+		t.Errorf("Capabilities returned %v after %d probes, expected the detected capabilities", err, probes)
+	}
+}
+
+func TestDetectCapabilities_Error(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/metrics/descriptors", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	if _, err := client.DetectCapabilities(ctx); err == nil {
+		t.Errorf("DetectCapabilities returned no error for a rejected token")
+	}
+}
+
+func TestData_MetricsLegacy(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Older backends have no v2/metrics/descriptors.
+	mux.HandleFunc("/data/metrics", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{
+			"net.request.count": {
+				"id": "net.request.count",
+				"name": "Number of Requests",
+				"namespaces": ["host", "kubernetes.cluster", "kubernetes.deployment"],
+				"type": "int",
+				"metricType": "counter",
+				"hidden": false
+			},
+			"cpu.cores.used": {
+				"namespaces": ["host", "kubernetes.cluster"],
+				"type": "double",
+				"metricType": "gauge",
+				"hidden": true
+			},
+			"host.hostName": {
+				"id": "host.hostName",
+				"namespaces": ["host"],
+				"type": "string",
+				"metricType": "segmentBy"
+			}
+		}`)
+	})
+
+	caps, err := client.DetectCapabilities(ctx)
+	if err != nil {
+		t.Fatalf("DetectCapabilities returned error: %v", err)
+	}
+	if caps.MetricDescriptors {
+		t.Errorf("DetectCapabilities returned %+v, expected no metric descriptors", caps)
+	}
+
+	payload, _, err := client.Data.Metrics(ctx)
+	if err != nil {
+		t.Fatalf("Data.Metrics returned error: %v", err)
+	}
+	if have, want := len(payload), 2; have != want {
+		t.Errorf("Data.Metrics returned %d items, expected %d", have, want)
+	}
+	if have, want := payload["cpu.cores.used"].ID, "cpu.cores.used"; have != want {
+		t.Errorf("Data.Metrics returned ID %q, expected %q", have, want)
+	}
+	if !payload["cpu.cores.used"].Hidden {
+		t.Errorf("Data.Metrics did not keep the hidden flag")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync"
 )
 
 const (
@@ -33,6 +34,10 @@ type Client struct {
 
 	// Services used for communicating with the API.
 	Data DataService
+
+	mu sync.Mutex
+	// Capabilities of the backend, once detected.
+	capabilities *Capabilities
 }
 
 // Response is a Sysdig Cloud response. This wraps the standard http.Response
@@ -178,6 +183,16 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}) (*Res
 	return response, err
 }
 
+// Ping checks the API can be reached and accepts the token of the client, by
+// requesting the current user.
+func (c *Client) Ping(ctx context.Context) (*Response, error) {
+	req, err := c.NewRequest(ctx, http.MethodGet, "user/me", nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(ctx, req, nil)
+}
+
 func (r *ErrorResponse) Error() string {
 	if r.RequestID != "" {
 		return fmt.Sprintf("%v %v: %d (request %q) %v",
@@ -144,6 +144,28 @@ func TestDo(t *testing.T) {
 	}
 }
 
+func TestPing(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/user/me", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.Header.Get("Authorization") != "Bearer "+agentAccessKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"user":{"username":"agent"}}`)
+	})
+
+	if _, err := client.Ping(ctx); err != nil {
+		t.Errorf("Ping returned error: %v", err)
+	}
+	client.Token = "<wrong-token>"
+	if resp, err := client.Ping(ctx); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Ping with a wrong token returned %v, expected status %d", err, http.StatusUnauthorized)
+	}
+}
+
 func TestCheckResponse(t *testing.T) {
 	res := &http.Response{
 		Request:    &http.Request{},
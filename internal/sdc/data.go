@@ -117,12 +117,26 @@ type MetricDefinition struct {
 	// - "string"
 	Type string `json:"type"`
 
+	// Scale multiplies raw values into the unit of Type.
+	Scale float64 `json:"scale,omitempty"`
+
+	// Category of the metric in Sysdig, e.g. "network".
+	Category string `json:"category,omitempty"`
+
+	// Heuristic is the heuristic flag of the Sysdig descriptor.
+	Heuristic bool `json:"heuristic,omitempty"`
+
 	// Possible values:
 	// - "counter"
 	// - "gauge"
 	// - "none", e.g.: id=kubernetes.service.name
 	// - "segmentBy", e.g.: id=host, id=port
 	MetricType string `json:"metricType"`
+
+	// Aggregations supported over time and across grouped entities, e.g.
+	// "avg", "max" or "p95".
+	TimeAggregations  []string `json:"timeAggregations,omitempty"`
+	GroupAggregations []string `json:"groupAggregations,omitempty"`
 }
 
 type MetricsList struct {
@@ -148,20 +162,35 @@ type MetricDescriptors struct {
 	Heuristic         bool          `json:"heuristic"`
 }
 
+// Metrics lists the metrics available for Kubernetes clusters, from
+// v2/metrics/descriptors or, on backends without it, from the legacy
+// data/metrics listing.
 func (s *DataServiceOp) Metrics(ctx context.Context) (Metrics, *Response, error) {
-	initialPath := fmt.Sprintf("v2/metrics/descriptors")
-	limit := 5000
-	offset := 0
-	path := initialPath + "?limit=" + fmt.Sprint(limit) + "&offset=" + fmt.Sprint(offset)
-	req, err := s.client.NewRequest(ctx, http.MethodGet, path, nil)
+	caps, err := s.client.Capabilities(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("unable to detect the capabilities of Sysdig: %v", err)
+	}
+	if !caps.MetricDescriptors {
+		return s.legacyMetrics(ctx)
 	}
-	metrics := MetricsList{}
-	resp, err := s.client.Do(ctx, req, &metrics)
-	cont := true
+	return s.metricDescriptors(ctx)
+}
+
+func (s *DataServiceOp) metricDescriptors(ctx context.Context) (Metrics, *Response, error) {
+	limit := 5000
+	offset := 0
 	metricsOld := Metrics{}
-	for cont == true {
+	for {
+		path := metricDescriptorsPath + "?limit=" + fmt.Sprint(limit) + "&offset=" + fmt.Sprint(offset)
+		req, err := s.client.NewRequest(ctx, http.MethodGet, path, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		metrics := MetricsList{}
+		resp, err := s.client.Do(ctx, req, &metrics)
+		if err != nil {
+			return nil, resp, err
+		}
 		for _, m := range metrics.MetricDescriptors {
 			metricDefinition := MetricDefinition{
 				ID:          m.ID,
@@ -172,28 +201,50 @@ func (s *DataServiceOp) Metrics(ctx context.Context) (Metrics, *Response, error)
 				GroupBy:     nil,
 				Namespaces:  m.Namespaces,
 				Type:        m.Type,
+				Scale:       m.Scale,
+				Category:    m.Category,
+				Heuristic:   m.Heuristic,
 				MetricType:  m.MetricType,
+
+				TimeAggregations:  m.TimeAggregations,
+				GroupAggregations: m.GroupAggregations,
 			}
 			//We only save the metrics with the label kubernetes.cluster
 			if hasNamespace(metricDefinition.Namespaces, "kubernetes.cluster") {
 				metricsOld[m.ID] = metricDefinition
 			}
 		}
-		if len(metrics.MetricDescriptors) == limit {
-			offset = offset + limit
-		} else {
-			cont = false
+		if len(metrics.MetricDescriptors) < limit {
 			return metricsOld, resp, nil
 		}
-		path = initialPath + "?limit=" + fmt.Sprint(limit) + "&offset=" + fmt.Sprint(offset)
-		req, err = s.client.NewRequest(ctx, http.MethodGet, path, nil)
-		resp, err = s.client.Do(ctx, req, &metrics)
-		if err != nil {
-			return nil, nil, err
-		}
+		offset = offset + limit
 	}
+}
 
-	return metricsOld, resp, nil
+// legacyMetrics lists the metrics from data/metrics, which returns every
+// metric definition in a single response, keyed by metric ID.
+func (s *DataServiceOp) legacyMetrics(ctx context.Context) (Metrics, *Response, error) {
+	path := fmt.Sprintf("%s/metrics", dataBasePath)
+	req, err := s.client.NewRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	all := Metrics{}
+	resp, err := s.client.Do(ctx, req, &all)
+	if err != nil {
+		return nil, resp, err
+	}
+	metrics := Metrics{}
+	for id, m := range all {
+		if m.ID == "" {
+			m.ID = id
+		}
+		// Like descriptors, only the metrics of Kubernetes clusters.
+		if hasNamespace(m.Namespaces, "kubernetes.cluster") {
+			metrics[id] = m
+		}
+	}
+	return metrics, resp, nil
 }
 
 func hasNamespace(namespaces []string, wanted string) bool {
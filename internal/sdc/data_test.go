@@ -3,6 +3,7 @@ package sdc
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -2363,7 +2364,7 @@ func TestData_Metrics(t *testing.T) {
 	setup()
 	defer teardown()
 
-	mux.HandleFunc("api/v2/metrics/descriptors", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/v2/metrics/descriptors", func(w http.ResponseWriter, r *http.Request) {
 		testMethod(t, r, http.MethodGet)
 		fmt.Fprint(w, metricsJSONResponse)
 	})
@@ -2373,16 +2374,59 @@ func TestData_Metrics(t *testing.T) {
 		t.Errorf("Data.Metrics returned error: %v", err)
 	}
 
-	if have, want := len(payload), 1; have != want {
+	// Every descriptor of the response describes Kubernetes clusters.
+	if have, want := len(payload), 48; have != want {
 		t.Errorf("Data.Metrics returned %d items, expected %d", have, want)
 	}
+	if have, want := payload["jvm.class.loaded"].Category, "jmx"; have != want {
+		t.Errorf("Data.Metrics returned category %q, expected %q", have, want)
+	}
+}
+
+func TestData_MetricsPages(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// A full page of descriptors is followed by a request for the next one.
+	const limit = 5000
+	var offsets []string
+	mux.HandleFunc("/v2/metrics/descriptors", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.URL.Query().Get("limit") == "1" {
+			// Capability probe.
+			fmt.Fprint(w, `{"metricDescriptors": []}`)
+			return
+		}
+		offset := r.URL.Query().Get("offset")
+		offsets = append(offsets, offset)
+		count := limit
+		if offset != "0" {
+			count = 2
+		}
+		descriptors := make([]string, count)
+		for i := range descriptors {
+			descriptors[i] = fmt.Sprintf(`{"id": "metric.%s.%d", "namespaces": ["kubernetes.cluster"]}`, offset, i)
+		}
+		fmt.Fprintf(w, `{"metricDescriptors": [%s]}`, strings.Join(descriptors, ","))
+	})
+
+	payload, _, err := client.Data.Metrics(ctx)
+	if err != nil {
+		t.Fatalf("Data.Metrics returned error: %v", err)
+	}
+	if have, want := len(payload), limit+2; have != want {
+		t.Errorf("Data.Metrics returned %d items, expected %d", have, want)
+	}
+	if have, want := strings.Join(offsets, ","), "0,5000"; have != want {
+		t.Errorf("Data.Metrics requested offsets %s, expected %s", have, want)
+	}
 }
 
 func TestData_Get(t *testing.T) {
 	setup()
 	defer teardown()
 
-	mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/data/", func(w http.ResponseWriter, r *http.Request) {
 		testMethod(t, r, http.MethodPost)
 		fmt.Fprint(w, getJSONResponse)
 	})